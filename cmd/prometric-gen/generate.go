@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// operationPrefixes maps method name prefixes to CRUD operations.
+var operationPrefixes = []struct {
+	operation string
+	prefixes  []string
+}{
+	{"create", []string{"Create", "Add", "Insert", "New", "Register"}},
+	{"get", []string{"Get", "Find", "Fetch", "Load", "Read", "Lookup"}},
+	{"list", []string{"List", "Search", "Query", "Count", "All"}},
+	{"update", []string{"Update", "Save", "Set", "Patch", "Put", "Upsert", "Modify"}},
+	{"delete", []string{"Delete", "Remove", "Destroy", "Purge"}},
+}
+
+// operationFor returns the operation of a method following the naming conventions.
+func operationFor(method string) string {
+	for _, op := range operationPrefixes {
+		for _, prefix := range op.prefixes {
+			if hasWordPrefix(method, prefix) {
+				return op.operation
+			}
+		}
+	}
+	return strings.ToLower(method)
+}
+
+// hasWordPrefix reports whether name starts with the word prefix, so "Getter" does not
+// match "Get" but "Get" and "GetByID" do.
+func hasWordPrefix(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	rest := name[len(prefix):]
+	return rest == "" || !unicode.IsLower(rune(rest[0]))
+}
+
+// objectFor derives the object label from an interface name, eg. "PersonRepository" gives "person".
+func objectFor(typeName string) string {
+	for _, suffix := range []string{"Repository", "Repo", "Store", "Service"} {
+		if trimmed := strings.TrimSuffix(typeName, suffix); trimmed != "" && trimmed != typeName {
+			return strings.ToLower(trimmed)
+		}
+	}
+	return strings.ToLower(typeName)
+}
+
+type method struct {
+	Name      string
+	Operation string
+	Skip      bool
+	Params    string
+	Results   string
+	Args      string
+	HasResult bool
+	HasError  bool
+}
+
+type decorator struct {
+	Package     string
+	Type        string
+	Constructor string
+	Object      string
+	Imports     []string
+	Time        string // name of the time package, if used
+	Methods     []method
+}
+
+// generate parses the package in dir and returns the source of the decorator of typeName.
+func generate(dir, typeName, object string) ([]byte, error) {
+	fset := token.NewFileSet()
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		spec := findInterface(file, typeName)
+		if spec == nil {
+			continue
+		}
+		if object == "" {
+			object = objectFor(typeName)
+		}
+		d, err := newDecorator(fset, file, spec, object, loadImports(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		return d.render()
+	}
+	return nil, fmt.Errorf("interface %s not found in %s", typeName, dir)
+}
+
+func findInterface(file *ast.File, typeName string) *ast.TypeSpec {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, s := range gen.Specs {
+			if ts := s.(*ast.TypeSpec); ts.Name.Name == typeName {
+				if _, ok := ts.Type.(*ast.InterfaceType); ok {
+					return ts
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// prometricsPath is the import path of the package used by the generated code.
+const prometricsPath = "github.com/peek8/prometric-go/prometrics"
+
+// newDecorator builds the decorator of the interface spec declared in file. pkgs describes
+// the packages imported by file, by import path.
+func newDecorator(fset *token.FileSet, file *ast.File, spec *ast.TypeSpec, object string, pkgs map[string]*importedPackage) (*decorator, error) {
+	if spec.TypeParams != nil {
+		return nil, fmt.Errorf("generic interface %s is not supported", spec.Name.Name)
+	}
+	d := &decorator{Package: file.Name.Name, Type: spec.Name.Name, Object: object}
+	d.Constructor = "New" + d.Type + "Metrics"
+	if !ast.IsExported(d.Type) {
+		d.Constructor = "new" + strings.ToUpper(d.Type[:1]) + d.Type[1:] + "Metrics"
+	}
+
+	type signature struct {
+		method          method
+		params, results []*ast.Field
+	}
+	var sigs []signature
+	used, idents := make(map[string]bool), make(map[string]bool)
+	needsTime := false
+	for _, field := range spec.Type.(*ast.InterfaceType).Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported", fset.Position(field.Pos()))
+		}
+		m := method{Name: field.Names[0].Name, Operation: operationFor(field.Names[0].Name)}
+		if field.Doc != nil {
+			for _, c := range field.Doc.List {
+				text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+				switch {
+				case text == "prometric:skip":
+					m.Skip = true
+				case strings.HasPrefix(text, "prometric:op "):
+					m.Operation = strings.TrimSpace(strings.TrimPrefix(text, "prometric:op "))
+				}
+			}
+		}
+		sig := signature{method: m, params: fieldList(fn.Params), results: fieldList(fn.Results)}
+		for _, f := range append(sig.params, sig.results...) {
+			collectNames(f.Type, used, idents)
+		}
+		if n := len(sig.results); n > 0 && exprString(fset, sig.results[n-1].Type) == "error" {
+			sig.method.HasError = true
+		} else if !m.Skip {
+			needsTime = true
+		}
+		sigs = append(sigs, sig)
+	}
+
+	// the imports of file referenced by the interface keep their name, unless it is one of
+	// the identifiers of the generated code, then they are renamed
+	taken := map[string]bool{"m": true, "err": true, "prometrics": true, "time": true}
+	for _, imp := range file.Imports {
+		if imp.Name != nil {
+			taken[imp.Name.Name] = true
+		}
+	}
+	for path, pkg := range pkgs {
+		if pkg.name != "" {
+			taken[pkg.name] = true
+		} else {
+			taken[importName(path)] = true
+		}
+	}
+	renamed := make(map[string]string)
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		pkg := pkgs[path]
+		name := importName(path)
+		if pkg != nil && pkg.name != "" {
+			name = pkg.name
+		}
+		local := name
+		if imp.Name != nil {
+			local = imp.Name.Name
+		}
+
+		switch {
+		case local == "_":
+			continue
+		case local == ".":
+			if pkg == nil || pkg.exports == nil || pkg.uses(idents) {
+				d.Imports = append(d.Imports, ". "+imp.Path.Value)
+			}
+			continue
+		case !used[local]:
+			continue
+		case path == prometricsPath && local == "prometrics":
+			continue
+		case path == "time" && local == "time":
+			// the generated code uses the time package too
+		case local == "m" || local == "err" || local == "prometrics" || local == "time":
+			renamed[local] = uniqueName(local+"pkg", taken)
+			local = renamed[local]
+		}
+		if path == "time" {
+			d.Time = local
+		}
+		if local != name {
+			d.Imports = append(d.Imports, local+" "+imp.Path.Value)
+		} else {
+			d.Imports = append(d.Imports, imp.Path.Value)
+		}
+	}
+	if needsTime && d.Time == "" {
+		d.Time = "time"
+		d.Imports = append(d.Imports, `"time"`)
+	}
+	if len(renamed) > 0 {
+		for _, sig := range sigs {
+			for _, f := range append(sig.params, sig.results...) {
+				renamePackages(f.Type, renamed)
+			}
+		}
+	}
+
+	// parameters must not shadow the identifiers used by the generated method bodies
+	reserved := map[string]bool{"_": true, "m": true, "err": true, "prometrics": true, "time": true}
+	if d.Time != "" {
+		reserved[d.Time] = true
+	}
+	for _, sig := range sigs {
+		m := sig.method
+		var params, args []string
+		for i, p := range sig.params {
+			name := fmt.Sprintf("p%d", i)
+			if len(p.Names) > 0 && !reserved[p.Names[0].Name] && !isGeneratedName(p.Names[0].Name) {
+				name = p.Names[0].Name
+			}
+			if _, variadic := p.Type.(*ast.Ellipsis); variadic {
+				args = append(args, name+"...")
+			} else {
+				args = append(args, name)
+			}
+			params = append(params, name+" "+exprString(fset, p.Type))
+		}
+
+		var results []string
+		for i, r := range sig.results {
+			name := fmt.Sprintf("r%d", i)
+			if i == len(sig.results)-1 && m.HasError {
+				name = "err"
+			}
+			results = append(results, name+" "+exprString(fset, r.Type))
+		}
+
+		m.Params = strings.Join(params, ", ")
+		m.Args = strings.Join(args, ", ")
+		m.HasResult = len(results) > 0
+		if m.HasResult {
+			m.Results = "(" + strings.Join(results, ", ") + ")"
+		}
+		d.Methods = append(d.Methods, m)
+	}
+	sort.Strings(d.Imports)
+	return d, nil
+}
+
+// uniqueName returns name, or name followed by a number, that is not taken yet, and takes it.
+func uniqueName(name string, taken map[string]bool) string {
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// importedPackage is a package imported by the file declaring the interface.
+type importedPackage struct {
+	name string
+	// exports are the exported top-level names of a dot import, nil if unknown
+	exports map[string]bool
+}
+
+// uses reports whether one of idents is exported by the package.
+func (p *importedPackage) uses(idents map[string]bool) bool {
+	for name := range idents {
+		if p.exports[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// loadImports loads the packages imported by file from dir like the go command would,
+// to find their names and, for dot imports, their exported names. The imports that
+// cannot be loaded are left out, their name is then guessed by importName.
+func loadImports(dir string, file *ast.File) map[string]*importedPackage {
+	var paths []string
+	dots := make(map[string]bool)
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		paths = append(paths, path)
+		if imp.Name != nil && imp.Name.Name == "." {
+			dots[path] = true
+		}
+	}
+	imported := make(map[string]*importedPackage)
+	if len(paths) == 0 {
+		return imported
+	}
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName | packages.NeedFiles, Dir: dir}, paths...)
+	if err != nil {
+		return imported
+	}
+	for _, pkg := range pkgs {
+		if pkg.Name == "" {
+			continue
+		}
+		p := &importedPackage{name: pkg.Name}
+		if dots[pkg.PkgPath] {
+			p.exports = exportedNames(pkg.GoFiles)
+		}
+		imported[pkg.PkgPath] = p
+	}
+	return imported
+}
+
+// exportedNames returns the exported top-level names declared in files, or nil if one of
+// them cannot be parsed.
+func exportedNames(files []string) map[string]bool {
+	fset := token.NewFileSet()
+	names := make(map[string]bool)
+	for _, name := range files {
+		f, err := parser.ParseFile(fset, name, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil
+		}
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, s := range gen.Specs {
+				switch s := s.(type) {
+				case *ast.TypeSpec:
+					names[s.Name.Name] = ast.IsExported(s.Name.Name)
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						names[n.Name] = ast.IsExported(n.Name)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// importName guesses the package name of an import path from its last element, skipping
+// a major version suffix and a "go-" prefix and stopping at the first character that
+// cannot appear in an identifier: "github.com/google/uuid", "example.com/uuid/v2",
+// "gopkg.in/uuid.v1" and "example.com/go-uuid" all give "uuid".
+func importName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = elems[len(elems)-2]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	if i := strings.IndexFunc(name, func(r rune) bool {
+		return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// isGeneratedName reports whether name has the form of a generated parameter or result
+// name, eg. p0 or r1.
+func isGeneratedName(name string) bool {
+	return len(name) > 1 && (name[0] == 'p' || name[0] == 'r') && strings.Trim(name[1:], "0123456789") == ""
+}
+
+// fieldList flattens a parameter list so that "a, b int" gives one field per name.
+func fieldList(fl *ast.FieldList) []*ast.Field {
+	if fl == nil {
+		return nil
+	}
+	var fields []*ast.Field
+	for _, f := range fl.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			field := &ast.Field{Type: f.Type}
+			if i < len(f.Names) {
+				field.Names = []*ast.Ident{f.Names[i]}
+			}
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// collectNames records the package names and the unqualified identifiers referenced by
+// a type expression.
+func collectNames(expr ast.Expr, packages, idents map[string]bool) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if id, ok := n.X.(*ast.Ident); ok {
+				packages[id.Name] = true
+				return false
+			}
+		case *ast.Field:
+			// skip the names of parameters and struct fields
+			collectNames(n.Type, packages, idents)
+			return false
+		case *ast.Ident:
+			idents[n.Name] = true
+		}
+		return true
+	})
+}
+
+// renamePackages renames the package names referenced by a type expression.
+func renamePackages(expr ast.Expr, renamed map[string]string) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				if name, ok := renamed[id.Name]; ok {
+					id.Name = name
+				}
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	format.Node(&buf, fset, expr)
+	return buf.String()
+}
+
+var decoratorTemplate = template.Must(template.New("decorator").Parse(`// Code generated by prometric-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+
+	"github.com/peek8/prometric-go/prometrics"
+)
+
+// {{.Type}}Metrics wraps a {{.Type}} and records CRUD metrics for object "{{.Object}}".
+type {{.Type}}Metrics struct {
+	next {{.Type}}
+}
+
+// {{.Constructor}} returns next wrapped with CRUD metrics.
+func {{.Constructor}}(next {{.Type}}) {{.Type}} {
+	return &{{.Type}}Metrics{next: next}
+}
+{{range .Methods}}
+func (m *{{$.Type}}Metrics) {{.Name}}({{.Params}}) {{.Results}} {
+{{- if not .Skip}}
+{{- if .HasError}}
+	defer prometrics.TrackCRUDErr("{{$.Object}}", "{{.Operation}}")(&err)
+{{- else}}
+	defer prometrics.TrackCRUD("{{$.Object}}", "{{.Operation}}")({{$.Time}}.Now())
+{{- end}}
+{{- end}}
+	{{if .HasResult}}return {{end}}m.next.{{.Name}}({{.Args}})
+}
+{{end}}`))
+
+func (d *decorator) render() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := decoratorTemplate.Execute(&buf, d); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
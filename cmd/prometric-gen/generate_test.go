@@ -0,0 +1,241 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const repositorySource = `package store
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+type Person struct{ ID int }
+
+type PersonRepository interface {
+	Create(ctx context.Context, p Person) (*Person, error)
+	GetByID(ctx context.Context, id int) (*Person, error)
+	ListSince(since time.Time, names ...string) []Person
+	//prometric:op archive
+	Archive(ctx context.Context, id int) error
+	//prometric:skip
+	Close() error
+}
+
+var _ io.Reader
+`
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "store.go"), []byte(repositorySource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := generate(dir, "PersonRepository", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkFiles(t, token.NewFileSet(), "store", prometricsImporter, map[string]string{
+		"store.go":                string(repositorySource),
+		"personrepository_gen.go": string(src),
+	}); err != nil {
+		t.Fatalf("generated code does not type-check: %v\n%s", err, src)
+	}
+
+	code := string(src)
+	for _, want := range []string{
+		"func NewPersonRepositoryMetrics(next PersonRepository) PersonRepository",
+		`defer prometrics.TrackCRUDErr("person", "create")(&err)`,
+		`defer prometrics.TrackCRUDErr("person", "get")(&err)`,
+		`defer prometrics.TrackCRUD("person", "list")(time.Now())`,
+		"return m.next.ListSince(since, names...)",
+		`defer prometrics.TrackCRUDErr("person", "archive")(&err)`,
+		"func (m *PersonRepositoryMetrics) Close() (err error) {\n\treturn m.next.Close()",
+		"func (m *PersonRepositoryMetrics) Create(ctx context.Context, p Person) (r0 *Person, err error)",
+		`"context"`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code misses %q\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, `"io"`) {
+		t.Errorf("generated code imports the unused package io\n%s", code)
+	}
+}
+
+// importSource is a repository importing packages whose name differs from the last
+// element of their path, with aliased and dot imports, and imports named like the
+// identifiers of the generated code.
+const importSource = `package store
+
+import (
+	"context"
+	t "time"
+
+	. "example.com/store/dot"
+	"example.com/store/gopkg.in/yaml.v3"
+	"example.com/store/kit"
+	"example.com/store/m"
+	"example.com/store/mattn/go-sqlite3"
+	prometrics "example.com/store/metrics"
+	. "example.com/store/unused"
+)
+
+type configStore interface {
+	Get(ctx context.Context, name string) (*yaml.Node, error)
+	Open(dsn string) (*sqlite3.Conn, error)
+	Save(ctx context.Context, t toolkit.Tag) error
+	Expire(after t.Duration) Entry
+	Merge(a m.Patch, b prometrics.Labels) error
+}
+
+var _ Unused
+`
+
+func TestGenerateImportNames(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                      "module example.com/store\n\ngo 1.25\n",
+		"store.go":                    importSource,
+		"gopkg.in/yaml.v3/yaml.go":    "package yaml\n\ntype Node struct{}\n",
+		"mattn/go-sqlite3/sqlite3.go": "package sqlite3\n\ntype Conn struct{}\n",
+		"kit/toolkit.go":              "package toolkit\n\ntype Tag string\n",
+		"dot/dot.go":                  "package dot\n\ntype Entry struct{}\n",
+		"m/m.go":                      "package m\n\ntype Patch struct{}\n",
+		"metrics/metrics.go":          "package prometrics\n\ntype Labels map[string]string\n",
+		"unused/unused.go":            "package unused\n\ntype Unused struct{}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src, err := generate(dir, "configStore", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+	for _, want := range []string{
+		`"example.com/store/gopkg.in/yaml.v3"`,
+		`"example.com/store/mattn/go-sqlite3"`,
+		`"example.com/store/kit"`,
+		`t "time"`,
+		`. "example.com/store/dot"`,
+		`mpkg "example.com/store/m"`,
+		`prometricspkg "example.com/store/metrics"`,
+		"func newConfigStoreMetrics(next configStore) configStore",
+		`defer prometrics.TrackCRUD("config", "expire")(t.Now())`,
+		"Save(ctx context.Context, p1 toolkit.Tag) (err error)",
+		"Merge(a mpkg.Patch, b prometricspkg.Labels) (err error)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code misses %s\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "example.com/store/unused") {
+		t.Errorf("generated code imports the unused dot import\n%s", code)
+	}
+
+	// type-check the generated code with the repository, the packages of the temporary
+	// module are checked from their source and the others imported from the build cache
+	fset := token.NewFileSet()
+	local := map[string]string{
+		"example.com/store/gopkg.in/yaml.v3": "gopkg.in/yaml.v3/yaml.go",
+		"example.com/store/mattn/go-sqlite3": "mattn/go-sqlite3/sqlite3.go",
+		"example.com/store/kit":              "kit/toolkit.go",
+		"example.com/store/dot":              "dot/dot.go",
+		"example.com/store/m":                "m/m.go",
+		"example.com/store/metrics":          "metrics/metrics.go",
+		"example.com/store/unused":           "unused/unused.go",
+	}
+	checked := make(map[string]*types.Package)
+	imp := importerFunc(func(path string) (*types.Package, error) {
+		if pkg, ok := checked[path]; ok {
+			return pkg, nil
+		}
+		if name, ok := local[path]; ok {
+			pkg, err := checkFiles(t, fset, path, nil, map[string]string{name: files[name]})
+			checked[path] = pkg
+			return pkg, err
+		}
+		return prometricsImporter.Import(path)
+	})
+	if _, err := checkFiles(t, fset, "example.com/store", imp, map[string]string{
+		"store.go":           importSource,
+		"configstore_gen.go": code,
+	}); err != nil {
+		t.Fatalf("generated code does not type-check: %v\n%s", err, src)
+	}
+}
+
+// prometricsImporter imports the standard library and prometrics from source, it is
+// shared by the tests as it caches the packages it imports.
+var prometricsImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// checkFiles parses and type-checks the files, given by name and content, of the package path.
+func checkFiles(t *testing.T, fset *token.FileSet, path string, imp types.Importer, files map[string]string) (*types.Package, error) {
+	t.Helper()
+	var parsed []*ast.File
+	for name, content := range files {
+		f, err := parser.ParseFile(fset, name, content, 0)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, f)
+	}
+	conf := types.Config{Importer: imp}
+	return conf.Check(path, fset, parsed, nil)
+}
+
+func TestImportName(t *testing.T) {
+	for path, want := range map[string]string{
+		"github.com/google/uuid":      "uuid",
+		"example.com/uuid/v2":         "uuid",
+		"gopkg.in/yaml.v3":            "yaml",
+		"github.com/mattn/go-sqlite3": "sqlite3",
+		"context":                     "context",
+	} {
+		if got := importName(path); got != want {
+			t.Errorf("importName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestOperationFor(t *testing.T) {
+	for name, want := range map[string]string{
+		"Create":     "create",
+		"AddMember":  "create",
+		"FindByName": "get",
+		"Getter":     "getter",
+		"CountAll":   "list",
+		"Save":       "update",
+		"RemoveByID": "delete",
+		"Ping":       "ping",
+	} {
+		if got := operationFor(name); got != want {
+			t.Errorf("operationFor(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if got := objectFor("PersonRepository"); got != "person" {
+		t.Errorf("objectFor = %q, want person", got)
+	}
+}
@@ -0,0 +1,64 @@
+// Command prometric-gen generates a decorator recording CRUD metrics for every method of a
+// repository interface, so TrackCRUD calls do not have to be written by hand.
+//
+// Add a go:generate directive next to the interface and run `go generate`:
+//
+//	//go:generate go run github.com/peek8/prometric-go/cmd/prometric-gen -type PersonRepository -object person
+//	type PersonRepository interface {
+//	    Create(ctx context.Context, p Person) (*Person, error)
+//	    Get(ctx context.Context, id int) (*Person, error)
+//	    //prometric:op archive
+//	    Archive(ctx context.Context, id int) error
+//	    //prometric:skip
+//	    Close() error
+//	}
+//
+// It writes personrepository_metrics.go with a PersonRepositoryMetrics type and its
+// constructor NewPersonRepositoryMetrics(next PersonRepository) PersonRepository, the
+// constructor of an unexported interface personRepo is newPersonRepoMetrics. The imports
+// of the interface keep their names, except those clashing with the identifiers of the
+// generated code (m, err, prometrics, time), which get a "pkg" suffix.
+// Methods whose last result is an error are tracked with prometrics.TrackCRUDErr, so
+// crud_operations_total gets their outcome, other methods with prometrics.TrackCRUD.
+//
+// The operation of a method is taken from its name prefix: Create, Add, Insert, New and
+// Register map to "create"; Get, Find, Fetch, Load, Read and Lookup to "get"; List, Search,
+// Query, Count and All to "list"; Update, Save, Set, Patch, Put, Upsert and Modify to
+// "update"; Delete, Remove, Destroy and Purge to "delete". Any other method uses its
+// lowercased name. A "//prometric:op <operation>" comment overrides the convention and a
+// "//prometric:skip" comment leaves the method uninstrumented.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeName := flag.String("type", "", "name of the interface to wrap (required)")
+	object := flag.String("object", "", "object label of the CRUD metrics (default: interface name without Repository/Repo/Store/Service suffix, lowercased)")
+	output := flag.String("output", "", "output file (default: <type>_metrics.go, lowercased)")
+	dir := flag.String("dir", ".", "directory of the package declaring the interface")
+	flag.Parse()
+
+	if *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output == "" {
+		*output = strings.ToLower(*typeName) + "_metrics.go"
+	}
+
+	src, err := generate(*dir, *typeName, *object)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "prometric-gen: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(filepath.Join(*dir, *output), src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "prometric-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
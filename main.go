@@ -1,11 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,7 +21,7 @@ type Person struct {
 
 var (
 	persons   = make(map[int]Person)
-	personMux sync.Mutex
+	personMux = prometrics.NewInstrumentedMutex("person")
 	nextID    = 1
 )
 
@@ -67,6 +67,16 @@ func httpApi() {
 	}
 	nextID++
 
+	// object_count{object="person"} always reflects the stored persons
+	err := prometrics.RegisterObjectCounter("person", func(ctx context.Context) (float64, error) {
+		personMux.Lock()
+		defer personMux.Unlock()
+		return float64(len(persons)), nil
+	})
+	if err != nil {
+		log.Fatalf("Object counter error: %v", err)
+	}
+
 	r := mux.NewRouter()
 
 	r.Handle("/person", prometrics.InstrumentHttpHandler("/person", http.HandlerFunc(createPerson))).Methods("POST")
@@ -10,86 +10,436 @@ package prometrics
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
 	"os"
 	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/shirou/gopsutil/process"
 )
 
+const (
+	// AppUptimeMetric is the total duration the application has been up, in seconds.
+	AppUptimeMetric = "app_uptime_seconds"
+	// MemoryAllocMetric is the heap memory allocated by the application, in bytes.
+	MemoryAllocMetric = "app_allocated_memory"
+	// CPUUsageMetric is the CPU usage of the Go process, in percent of one core.
+	CPUUsageMetric = "app_cpu_usage_percent"
+	// GoroutinesMetric is the number of current goroutines.
+	GoroutinesMetric = "app_go_routines"
+	// GCCountMetric is the total number of completed garbage collections.
+	GCCountMetric = "app_garbage_collections_count"
+)
+
+// Health metric vectors of earlier versions. The health metrics are exported by
+// HealthCollector, these vectors are not registered anymore: they mirror the last values
+// computed by a HealthCollector, so code reading them keeps working.
 var (
 	// AppUptime keep track of  the Total duration of Application is being up
 	// Metric type: GaugeVec
-	AppUptime = CreateGauge("app_uptime_seconds", "App uptime in seconds", nil)
+	//
+	// Deprecated: app_uptime_seconds is exported by HealthCollector, use HealthCollector.Values.
+	AppUptime = newLegacyGauge(AppUptimeMetric, "App uptime in seconds")
 
 	// Mmory allocated by the app in bytes
 	// Metric type: GaugeVec
-	MemoryAlloc = CreateGauge("app_allocated_memory", "Memory allocated in bytes", nil)
+	//
+	// Deprecated: app_allocated_memory is exported by HealthCollector, use HealthCollector.Values.
+	MemoryAlloc = newLegacyGauge(MemoryAllocMetric, "Memory allocated in bytes")
 
 	// CPU usage of the Go process
-	CPUUsageGauge = CreateGauge("app_cpu_usage_percent", "CPU usage of the Go process (percent).", nil)
+	//
+	// Deprecated: app_cpu_usage_percent is exported by HealthCollector, use HealthCollector.Values.
+	CPUUsageGauge = newLegacyGauge(CPUUsageMetric, "CPU usage of the Go process (percent).")
 
 	// Number of Current goroutines
 	// Metric type: GaugeVec
-	Goroutines = CreateGauge("app_go_routines", "Number of Current goroutines", nil)
+	//
+	// Deprecated: app_go_routines is exported by HealthCollector, use HealthCollector.Values.
+	Goroutines = newLegacyGauge(GoroutinesMetric, "Number of Current goroutines")
 
 	// Number of Total garbage collections
 	// Metric type: CounterVec
-	GCCount = CreateCounter("app_garbage_collections_count", "Total garbage collections", nil)
+	//
+	// Deprecated: app_garbage_collections_count is exported by HealthCollector, use HealthCollector.Values.
+	GCCount = prometheus.NewCounterVec(prometheus.CounterOpts{Name: GCCountMetric, Help: "Total garbage collections"}, nil)
 )
+
+func newLegacyGauge(name, help string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, nil)
+}
+
+var legacyHealth struct {
+	mu      sync.Mutex
+	gcCount uint64
+}
+
+// updateLegacyHealthMetrics mirrors v into the deprecated health metric vectors.
+func updateLegacyHealthMetrics(v HealthValues) {
+	legacyHealth.mu.Lock()
+	defer legacyHealth.mu.Unlock()
+
+	AppUptime.WithLabelValues().Set(v.Uptime.Seconds())
+	MemoryAlloc.WithLabelValues().Set(float64(v.MemoryAlloc))
+	Goroutines.WithLabelValues().Set(float64(v.Goroutines))
+	if v.GCCount > legacyHealth.gcCount {
+		GCCount.WithLabelValues().Add(float64(v.GCCount - legacyHealth.gcCount))
+		legacyHealth.gcCount = v.GCCount
+	}
+	if v.CPUValid {
+		CPUUsageGauge.WithLabelValues().Set(v.CPUPercent)
+	}
+}
+
 var startTime = time.Now()
 
-func updateHealthMetrics() {
-	var mem runtime.MemStats
-	runtime.ReadMemStats(&mem)
+// Build information that can be injected at link time, taking precedence over the values
+// found by debug.ReadBuildInfo:
+//
+//	go build -ldflags "-X github.com/peek8/prometric-go/prometrics.BuildVersion=1.4.2 \
+//	    -X github.com/peek8/prometric-go/prometrics.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	BuildVersion  string
+	BuildRevision string
+	BuildTime     string
+)
+
+var (
+	// AppBuildInfo is always 1 and carries the build information of the application as labels,
+	// so every other series can be joined to the deployed version in PromQL:
+	//
+	//	rate(http_requests_total[5m]) * on() group_left(version) app_build_info
+	//
+	// It is registered with the default registry and filled automatically, see BuildVersion
+	// and SetBuildInfo. To expose it from a custom registry, register it there as well.
+	//
+	// Metric type: GaugeVec
+	AppBuildInfo = CreateGauge("app_build_info", "Build information of the application, always 1.",
+		[]string{"version", "revision", "go_version", "module", "vcs_modified", "vcs_time", "build_time"})
+)
+
+// BuildInfo holds the label values of app_build_info.
+type BuildInfo struct {
+	Version     string
+	Revision    string
+	GoVersion   string
+	Module      string
+	VCSModified string
+	// VCSTime is the time of the commit the binary was built from.
+	VCSTime string
+	// BuildTime is the time the binary was built, only known when set through ldflags.
+	BuildTime string
+}
+
+func init() {
+	SetBuildInfo(ReadBuildInfo())
+}
+
+// ReadBuildInfo returns the build information of the running binary from
+// debug.ReadBuildInfo and its VCS settings, overridden by BuildVersion and BuildRevision
+// when set through ldflags. The build time is not recorded by the Go toolchain, it is
+// only known from BuildTime.
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Version = bi.Main.Version
+		info.Module = bi.Main.Path
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Revision = s.Value
+			case "vcs.modified":
+				info.VCSModified = s.Value
+			case "vcs.time":
+				info.VCSTime = s.Value
+			}
+		}
+	}
+	if BuildVersion != "" {
+		info.Version = BuildVersion
+	}
+	if BuildRevision != "" {
+		info.Revision = BuildRevision
+	}
+	if BuildTime != "" {
+		info.BuildTime = BuildTime
+	}
+	return info
+}
+
+// SetBuildInfo replaces the labels of app_build_info, eg. for values only known at runtime.
+func SetBuildInfo(info BuildInfo) {
+	AppBuildInfo.Reset()
+	AppBuildInfo.WithLabelValues(info.Version, info.Revision, info.GoVersion, info.Module, info.VCSModified, info.VCSTime, info.BuildTime).Set(1)
+}
+
+const (
+	heapObjectsBytesSample = "/memory/classes/heap/objects:bytes"
+	gcCyclesSample         = "/gc/cycles/total:gc-cycles"
+)
+
+// HealthCollector is a prometheus.Collector for the application health metrics, ie
+// app uptime, allocated memory, CPU usage, goroutines and garbage collections.
+//
+// All values are computed when the registry is scraped. Memory and GC values are read
+// through runtime/metrics, which unlike runtime.ReadMemStats does not stop the world,
+// and the garbage collection count is exported as a proper cumulative counter.
+type HealthCollector struct {
+	uptime     *prometheus.Desc
+	memory     *prometheus.Desc
+	cpu        *prometheus.Desc
+	goroutines *prometheus.Desc
+	gcCount    *prometheus.Desc
+
+	families []healthFamily
+
+	mu       sync.Mutex
+	proc     *process.Process
+	cpuUsage cpuMeter
+	samples  []metrics.Sample
+}
+
+// NewHealthCollector creates a HealthCollector. Use RegisterHealthCollector to create
+// and register it in one go.
+//
+// Further process metrics (RSS, file descriptors, threads, I/O...) can be enabled one
+// family at a time with HealthOption values, eg. WithProcessMemory, so the cost of
+// collecting them stays under control.
+func NewHealthCollector(opts ...HealthOption) *HealthCollector {
+	c := &HealthCollector{
+		uptime:     prometheus.NewDesc(AppUptimeMetric, "App uptime in seconds", nil, nil),
+		memory:     prometheus.NewDesc(MemoryAllocMetric, "Memory allocated in bytes", nil, nil),
+		cpu:        prometheus.NewDesc(CPUUsageMetric, "CPU usage of the Go process (percent).", nil, nil),
+		goroutines: prometheus.NewDesc(GoroutinesMetric, "Number of Current goroutines", nil, nil),
+		gcCount:    prometheus.NewDesc(GCCountMetric, "Total garbage collections", nil, nil),
+		samples: []metrics.Sample{
+			{Name: heapObjectsBytesSample},
+			{Name: gcCyclesSample},
+		},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.cpuUsage = newCPUMeter()
+	c.proc = c.cpuUsage.proc
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *HealthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.uptime
+	ch <- c.memory
+	ch <- c.cpu
+	ch <- c.goroutines
+	ch <- c.gcCount
+	for _, f := range c.families {
+		for _, d := range f.descs {
+			ch <- d
+		}
+	}
+}
+
+// HealthValues holds the application health values computed by a HealthCollector.
+type HealthValues struct {
+	Uptime      time.Duration
+	MemoryAlloc uint64
+	Goroutines  int
+	GCCount     uint64
+	// CPUPercent is the CPU usage since the previous call, valid only if CPUValid is true.
+	CPUPercent float64
+	CPUValid   bool
+}
+
+// Values computes the health values exported by the collector. The CPU usage is measured
+// since the previous call to Values or Collect on the same collector.
+func (c *HealthCollector) Values() HealthValues {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values()
+}
+
+func (c *HealthCollector) values() HealthValues {
+	v := c.read(&c.cpuUsage)
+	updateLegacyHealthMetrics(v)
+	return v
+}
+
+// valuesWith computes the health values like Values, the CPU usage being measured by cpu
+// instead of the collector, so neither the CPU usage window of the collector nor the
+// deprecated vectors change.
+func (c *HealthCollector) valuesWith(cpu *cpuMeter) HealthValues {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.read(cpu)
+}
+
+// read computes the health values with the CPU usage measured by cpu, c.mu must be held.
+func (c *HealthCollector) read(cpu *cpuMeter) HealthValues {
+	metrics.Read(c.samples)
+	v := HealthValues{
+		Uptime:      time.Since(startTime),
+		MemoryAlloc: c.samples[0].Value.Uint64(),
+		Goroutines:  runtime.NumGoroutine(),
+		GCCount:     c.samples[1].Value.Uint64(),
+	}
+	v.CPUPercent, v.CPUValid = cpu.percent()
+	return v
+}
+
+// Collect implements prometheus.Collector.
+func (c *HealthCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v := c.values()
+	ch <- prometheus.MustNewConstMetric(c.uptime, prometheus.GaugeValue, v.Uptime.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.memory, prometheus.GaugeValue, float64(v.MemoryAlloc))
+	ch <- prometheus.MustNewConstMetric(c.goroutines, prometheus.GaugeValue, float64(v.Goroutines))
+	ch <- prometheus.MustNewConstMetric(c.gcCount, prometheus.CounterValue, float64(v.GCCount))
+	if v.CPUValid {
+		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.GaugeValue, v.CPUPercent)
+	}
+
+	for _, f := range c.families {
+		// a family that is not supported on this platform is simply left out
+		_ = f.collect(ch)
+	}
+}
 
-	AppUptime.WithLabelValues().Set(time.Since(startTime).Seconds())
-	MemoryAlloc.WithLabelValues().Set(float64(mem.Alloc))
-	Goroutines.WithLabelValues().Set(float64(runtime.NumGoroutine()))
-	GCCount.WithLabelValues().Add(float64(mem.NumGC))
+// cpuMeter measures the CPU usage of the process. Every meter has its own process
+// handle, which keeps the CPU times of the previous measure as its baseline.
+type cpuMeter struct {
+	proc    *process.Process
+	sampled bool
+}
 
+func newCPUMeter() cpuMeter {
 	proc, err := process.NewProcess(int32(os.Getpid()))
 	if err != nil {
-		log.Printf("Failed to create process handle: %v", err)
-		return
+		logger().Error("process handle creation failed", "error", err)
 	}
+	return cpuMeter{proc: proc}
+}
 
-	// CPU percent (since last call)
-	if cpuPercent, err := proc.CPUPercent(); err == nil {
-		CPUUsageGauge.WithLabelValues().Set(cpuPercent)
+// percent returns the CPU usage since the previous measure, or since the process
+// started on the first one.
+func (m *cpuMeter) percent() (float64, bool) {
+	if m.proc == nil {
+		return 0, false
 	}
+	first := !m.sampled
+	m.sampled = true
+	percent, err := m.proc.Percent(0)
+	if err != nil {
+		return 0, false
+	}
+	if first {
+		if percent, err = m.proc.CPUPercent(); err != nil {
+			return 0, false
+		}
+	}
+	return percent, true
 }
 
-// CollectSystemMetricsLoop function collects system health information eg cpu, memory in some interval time ie intervalSecs.
-// It should be called in a go routine
+// RegisterHealthCollector creates a HealthCollector with the given options and registers
+// it with reg, or with prometheus.DefaultRegisterer if reg is nil.
 //
 // Example:
-// if we want to collect metrics in 10 seconds interval, it should be called as follows:
 //
-//	ctx, cancel := context.WithCancel(context.Background(), 10)
-//	go collectSystemMetricsLoop(ctx)
+//	reg := prometheus.NewRegistry()
+//	if err := prometrics.RegisterHealthCollector(reg); err != nil {
+//	    log.Fatal(err)
+//	}
+//	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+func RegisterHealthCollector(reg prometheus.Registerer, opts ...HealthOption) error {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	c := NewHealthCollector(opts...)
+	if err := reg.Register(c); err != nil {
+		return err
+	}
+	if reg == prometheus.DefaultRegisterer {
+		defaultHealth.mu.Lock()
+		defaultHealth.c = c
+		defaultHealth.mu.Unlock()
+	}
+	return nil
+}
+
+// defaultHealth is the HealthCollector registered with the default registry.
+var defaultHealth struct {
+	mu sync.Mutex
+	c  *HealthCollector
+}
+
+// registerDefaultHealthCollector registers a HealthCollector with the default registry
+// unless one is registered already, and returns it.
+func registerDefaultHealthCollector() *HealthCollector {
+	defaultHealth.mu.Lock()
+	defer defaultHealth.mu.Unlock()
+	if defaultHealth.c != nil {
+		return defaultHealth.c
+	}
+
+	c := NewHealthCollector()
+	var are prometheus.AlreadyRegisteredError
+	err := prometheus.DefaultRegisterer.Register(c)
+	switch {
+	case err == nil:
+	case errors.As(err, &are):
+		if existing, ok := are.ExistingCollector.(*HealthCollector); ok {
+			c = existing
+		}
+	default:
+		logger().Error("health collector registration failed", "error", err)
+		// the values are still usable, they are just not exported
+		return c
+	}
+	defaultHealth.c = c
+	return c
+}
+
+// legacyHealthLoop registers the refresh of the deprecated health vectors once.
+var legacyHealthLoop sync.Once
+
+// CollectSystemMetricsLoop exposes the application health metrics and runs the periodic
+// collectors registered with RegisterPeriodicCollector until ctx is cancelled.
+// It should be called in a go routine. The health metrics are computed at scrape time,
+// intervalSecs is the interval at which the deprecated AppUptime, MemoryAlloc,
+// CPUUsageGauge, Goroutines and GCCount vectors are refreshed, zero or less disables it.
+// Only the interval of the first call enabling the refresh is used.
 //
-// It can be cancelled any time by calling `cancel()`
+// Deprecated: use RegisterHealthCollector and RunPeriodicCollectors.
 func CollectSystemMetricsLoop(ctx context.Context, intervalSecs int) {
-	ticker := time.NewTicker(time.Duration(intervalSecs) * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			updateHealthMetrics()
-		case <-ctx.Done():
-			fmt.Println("Metrics loop stopped gracefully")
-			return
-		}
+	c := registerDefaultHealthCollector()
+	if intervalSecs > 0 {
+		legacyHealthLoop.Do(func() {
+			// the refresh has its own CPU baseline, it does not shorten the window of scrapes
+			cpu := newCPUMeter()
+			err := RegisterPeriodicCollector("legacy_health_metrics", time.Duration(intervalSecs)*time.Second, func(context.Context) error {
+				updateLegacyHealthMetrics(c.valuesWith(&cpu))
+				return nil
+			})
+			if err != nil {
+				logger().Error("legacy health metrics registration failed", "error", err)
+			}
+		})
 	}
+	RunPeriodicCollectors(ctx)
 }
 
-// HealthMiddleware instruments an http.Handler with Prometheus metrics.
-// It records application health related metrics such as app uptim, memory allocated, current go routies and total garbage collectors.
+// HealthMiddleware makes sure the application health metrics, such as app uptime, memory
+// allocated, current go routines and total garbage collections, are exposed by the default
+// registry. Requests are passed on to next untouched, the metrics are computed at scrape
+// time by HealthCollector. It is equivalent to calling RegisterHealthCollector(nil).
 //
 // Example:
 //
@@ -97,8 +447,6 @@ func CollectSystemMetricsLoop(ctx context.Context, intervalSecs int) {
 //	    prometrics.HealthMiddleware(promhttp.Handler()),
 //	)
 func HealthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		updateHealthMetrics()
-		next.ServeHTTP(w, r)
-	})
+	registerDefaultHealthCollector()
+	return next
 }
@@ -0,0 +1,118 @@
+package prometrics
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHealthCollectorGCCountIsCumulative(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if err := RegisterHealthCollector(reg); err != nil {
+		t.Fatal(err)
+	}
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	// scraping several times must not add up the cumulative count again
+	for i := 0; i < 3; i++ {
+		if _, err := reg.Gather(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != GCCountMetric {
+			continue
+		}
+		got := mf.GetMetric()[0].GetCounter().GetValue()
+		if got < float64(before.NumGC) || got > float64(before.NumGC)+5 {
+			t.Errorf("%s = %v, want about %d", GCCountMetric, got, before.NumGC)
+		}
+		return
+	}
+	t.Errorf("%s not exported", GCCountMetric)
+}
+
+func TestHealthMiddlewareRegistersOnce(t *testing.T) {
+	HealthMiddleware(nil)
+	HealthMiddleware(nil)
+	GinHealthMiddleware()
+
+	if n, err := testutil.GatherAndCount(prometheus.DefaultGatherer, AppUptimeMetric); err != nil || n != 1 {
+		t.Errorf("%s series = %d, %v, want 1", AppUptimeMetric, n, err)
+	}
+}
+
+func TestHealthCollectorUpdatesLegacyVectors(t *testing.T) {
+	runtime.GC()
+	v := NewHealthCollector().Values()
+
+	if got := testutil.ToFloat64(Goroutines.WithLabelValues()); got != float64(v.Goroutines) {
+		t.Errorf("Goroutines = %v, want %d", got, v.Goroutines)
+	}
+	if got := testutil.ToFloat64(GCCount.WithLabelValues()); got < float64(v.GCCount) || got == 0 {
+		t.Errorf("GCCount = %v, want at least %d", got, v.GCCount)
+	}
+	if got := testutil.ToFloat64(AppUptime.WithLabelValues()); got != v.Uptime.Seconds() {
+		t.Errorf("AppUptime = %v, want %v", got, v.Uptime.Seconds())
+	}
+}
+
+func TestCollectSystemMetricsLoopTwice(t *testing.T) {
+	var logs bytes.Buffer
+	s := NewScheduler(WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	defer func(d *Scheduler) { DefaultScheduler = d }(DefaultScheduler)
+	DefaultScheduler = s
+	legacyHealthLoop = sync.Once{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	CollectSystemMetricsLoop(ctx, 1)
+	CollectSystemMetricsLoop(ctx, 1)
+
+	if bytes.Contains(logs.Bytes(), []byte("level=ERROR")) {
+		t.Errorf("calling CollectSystemMetricsLoop twice logged an error:\n%s", logs.String())
+	}
+	if _, ok := s.collectors["legacy_health_metrics"]; !ok {
+		t.Error("the legacy health metrics are not refreshed")
+	}
+}
+
+func TestHealthCollectorProcessFamilies(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if err := RegisterHealthCollector(reg, WithProcessMemory(), WithFileDescriptors(), WithThreads()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"app_process_resident_memory_bytes", "app_process_open_fds", "app_process_threads"} {
+		if n, err := testutil.GatherAndCount(reg, name); err != nil || n != 1 {
+			t.Errorf("%s series = %d, %v, want 1", name, n, err)
+		}
+	}
+	// families that were not enabled are not collected
+	if n, _ := testutil.GatherAndCount(reg, "app_process_io_read_bytes_total"); n != 0 {
+		t.Errorf("app_process_io_read_bytes_total series = %d, want 0", n)
+	}
+}
+
+func TestHealthCollectorOptionsCombined(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if err := RegisterHealthCollector(reg, WithAllProcessMetrics(), WithFileDescriptors(), WithFileDescriptors()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,168 @@
+package prometrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// CacheHitsTotal counts the cache lookups that found an entry, labeled by cache name.
+	//
+	// Metric type: CounterVec
+	CacheHitsTotal = CreateCounter("cache_hits_total", "Total cache lookups that found an entry", []string{"cache"})
+	// CacheMissesTotal counts the cache lookups that found no entry, labeled by cache name.
+	// The hit ratio is rate(cache_hits_total[5m]) / (rate(cache_hits_total[5m]) + rate(cache_misses_total[5m])).
+	//
+	// Metric type: CounterVec
+	CacheMissesTotal = CreateCounter("cache_misses_total", "Total cache lookups that found no entry", []string{"cache"})
+	// CacheSetsTotal counts the entries written to a cache, labeled by cache name.
+	//
+	// Metric type: CounterVec
+	CacheSetsTotal = CreateCounter("cache_sets_total", "Total cache entries written", []string{"cache"})
+	// CacheEvictionsTotal counts the entries removed from a cache, labeled by cache name and
+	// reason (expired, capacity, deleted...).
+	//
+	// Metric type: CounterVec
+	CacheEvictionsTotal = CreateCounter("cache_evictions_total", "Total cache entries evicted by reason", []string{"cache", "reason"})
+	// CacheEntries reports the current number of entries of a cache, labeled by cache name.
+	//
+	// Metric type: GaugeVec
+	CacheEntries = CreateGauge("cache_entries", "Current number of cache entries", []string{"cache"})
+	// CacheSizeBytes reports the current size of a cache in bytes, labeled by cache name.
+	//
+	// Metric type: GaugeVec
+	CacheSizeBytes = CreateGauge("cache_size_bytes", "Current size of the cache in bytes", []string{"cache"})
+	// CacheLookupDuration tracks the duration of cache lookups in seconds, labeled by cache name.
+	//
+	// Metric type: HistogramVec
+	CacheLookupDuration = CreateHistogram("cache_lookup_duration_seconds", "Duration of cache lookups in seconds", []string{"cache"}, prometheus.ExponentialBuckets(0.00001, 4, 10))
+)
+
+// Eviction reasons of cache_evictions_total.
+const (
+	EvictionExpired  = "expired"
+	EvictionCapacity = "capacity"
+	EvictionDeleted  = "deleted"
+)
+
+// CacheMetrics records the standard metrics of one cache. The label values are resolved
+// once, so recording is cheap enough for hot paths.
+type CacheMetrics struct {
+	name    string
+	hits    prometheus.Counter
+	misses  prometheus.Counter
+	sets    prometheus.Counter
+	entries prometheus.Gauge
+	size    prometheus.Gauge
+	lookup  prometheus.Observer
+}
+
+// NewCacheMetrics returns the CacheMetrics of the cache called name.
+//
+// Example:
+//
+//	metrics := prometrics.NewCacheMetrics("sessions")
+//	done := metrics.TrackLookup()
+//	session, ok := sessions[id]
+//	done(ok)
+func NewCacheMetrics(name string) *CacheMetrics {
+	return &CacheMetrics{
+		name:    name,
+		hits:    CacheHitsTotal.WithLabelValues(name),
+		misses:  CacheMissesTotal.WithLabelValues(name),
+		sets:    CacheSetsTotal.WithLabelValues(name),
+		entries: CacheEntries.WithLabelValues(name),
+		size:    CacheSizeBytes.WithLabelValues(name),
+		lookup:  CacheLookupDuration.WithLabelValues(name),
+	}
+}
+
+// Hit counts a lookup that found an entry.
+func (m *CacheMetrics) Hit() { m.hits.Inc() }
+
+// Miss counts a lookup that found no entry.
+func (m *CacheMetrics) Miss() { m.misses.Inc() }
+
+// Set counts an entry written to the cache.
+func (m *CacheMetrics) Set() { m.sets.Inc() }
+
+// Evict counts an entry removed from the cache for reason, eg. EvictionExpired.
+func (m *CacheMetrics) Evict(reason string) {
+	CacheEvictionsTotal.WithLabelValues(m.name, reason).Inc()
+}
+
+// SetEntries sets the current number of entries of the cache.
+func (m *CacheMetrics) SetEntries(n int) { m.entries.Set(float64(n)) }
+
+// SetSizeBytes sets the current size of the cache in bytes.
+func (m *CacheMetrics) SetSizeBytes(n int64) { m.size.Set(float64(n)) }
+
+// TrackLookup records a cache lookup. It should be called right before the lookup, the
+// returned function is called with its result and observes the lookup duration.
+func (m *CacheMetrics) TrackLookup() func(hit bool) {
+	start := time.Now()
+	return func(hit bool) {
+		m.lookup.Observe(time.Since(start).Seconds())
+		if hit {
+			m.hits.Inc()
+		} else {
+			m.misses.Inc()
+		}
+	}
+}
+
+// Cache is the interface of the caches wrapped by InstrumentCache.
+type Cache[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V)
+	Delete(key K)
+}
+
+// InstrumentedCache is a Cache recording its metrics with CacheMetrics.
+type InstrumentedCache[K comparable, V any] struct {
+	cache   Cache[K, V]
+	metrics *CacheMetrics
+}
+
+// InstrumentCache wraps cache so that lookups, sets and deletes are recorded under name.
+// Deletes are counted as evictions with reason EvictionDeleted. If cache has a Len() int
+// method, the entry count is updated after every write.
+//
+// Example:
+//
+//	var users prometrics.Cache[string, *User] = prometrics.InstrumentCache("users", newLRU())
+func InstrumentCache[K comparable, V any](name string, cache Cache[K, V]) *InstrumentedCache[K, V] {
+	return &InstrumentedCache[K, V]{cache: cache, metrics: NewCacheMetrics(name)}
+}
+
+// Metrics returns the CacheMetrics of the cache, eg. to record evictions from an eviction callback.
+func (c *InstrumentedCache[K, V]) Metrics() *CacheMetrics { return c.metrics }
+
+// Get implements Cache.
+func (c *InstrumentedCache[K, V]) Get(key K) (V, bool) {
+	done := c.metrics.TrackLookup()
+	v, ok := c.cache.Get(key)
+	done(ok)
+	return v, ok
+}
+
+// Set implements Cache.
+func (c *InstrumentedCache[K, V]) Set(key K, value V) {
+	c.cache.Set(key, value)
+	c.metrics.Set()
+	c.updateEntries()
+}
+
+// Delete implements Cache.
+func (c *InstrumentedCache[K, V]) Delete(key K) {
+	c.cache.Delete(key)
+	c.metrics.Evict(EvictionDeleted)
+	c.updateEntries()
+}
+
+func (c *InstrumentedCache[K, V]) updateEntries() {
+	if l, ok := c.cache.(interface{ Len() int }); ok {
+		c.metrics.SetEntries(l.Len())
+	}
+}
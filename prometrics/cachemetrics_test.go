@@ -0,0 +1,42 @@
+package prometrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type mapCache map[string]int
+
+func (m mapCache) Get(key string) (int, bool) { v, ok := m[key]; return v, ok }
+func (m mapCache) Set(key string, value int)  { m[key] = value }
+func (m mapCache) Delete(key string)          { delete(m, key) }
+func (m mapCache) Len() int                   { return len(m) }
+
+func TestInstrumentCache(t *testing.T) {
+	name := uniqueTestName("test-cache")
+	var cache Cache[string, int] = InstrumentCache[string, int](name, mapCache{})
+
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Get("a")
+	cache.Get("a")
+	cache.Get("missing")
+	cache.Delete("b")
+
+	if got := testutil.ToFloat64(CacheHitsTotal.WithLabelValues(name)); got != 2 {
+		t.Errorf("hits = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(CacheMissesTotal.WithLabelValues(name)); got != 1 {
+		t.Errorf("misses = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(CacheSetsTotal.WithLabelValues(name)); got != 2 {
+		t.Errorf("sets = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(CacheEvictionsTotal.WithLabelValues(name, EvictionDeleted)); got != 1 {
+		t.Errorf("evictions = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(CacheEntries.WithLabelValues(name)); got != 1 {
+		t.Errorf("entries = %v, want 1", got)
+	}
+}
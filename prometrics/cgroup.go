@@ -0,0 +1,344 @@
+package prometrics
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultCgroupRoot is where the cgroup filesystem is mounted in a container.
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// selfCgroupFile lists the cgroups of the current process.
+const selfCgroupFile = "/proc/self/cgroup"
+
+// cgroupStats are the values read from the cgroup filesystem. Limits are zero when unlimited.
+type cgroupStats struct {
+	cpuQuota          float64 // in cores
+	cpuUsage          float64 // in seconds
+	cpuPeriods        float64
+	cpuThrottled      float64
+	cpuThrottledTime  float64 // in seconds
+	memoryLimit       float64 // in bytes
+	memoryUsage       float64 // in bytes
+	oomEvents         float64
+	hasCPUStat        bool
+	hasMemoryOOMCount bool
+}
+
+// cgroupReader reads cgroup v1 or v2 statistics of the cgroup of the process below root.
+// The cgroup of the process is resolved from self, in the /proc/self/cgroup format;
+// without it the statistics are read from root itself.
+type cgroupReader struct {
+	root string
+	self string
+}
+
+// v2 reports whether root is a cgroup v2 (unified) hierarchy.
+func (r cgroupReader) v2() bool {
+	_, err := os.Stat(filepath.Join(r.root, "cgroup.controllers"))
+	return err == nil
+}
+
+func (r cgroupReader) read() (cgroupStats, error) {
+	var paths map[string]string
+	if r.self != "" {
+		// without the file, eg. outside of Linux, the statistics of root are read
+		paths, _ = readCgroupPaths(r.self)
+	}
+	if r.v2() {
+		return r.readV2(cgroupDir(r.root, paths[""]))
+	}
+	return r.readV1(paths)
+}
+
+// readCgroupPaths reads a file in the /proc/self/cgroup format, one
+// "<hierarchy id>:<controllers>:<path>" line per hierarchy, and maps every controller
+// to the path of the process cgroup in its hierarchy. The cgroup v2 path, whose
+// controller list is empty, is mapped to "".
+func readCgroupPaths(file string) (map[string]string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[strings.TrimPrefix(controller, "name=")] = parts[2]
+		}
+	}
+	return paths, nil
+}
+
+// cgroupDir returns the directory of the cgroup at path in the hierarchy mounted at base.
+// When the cgroup namespace of a container is not private, /proc/self/cgroup shows the
+// path on the host while base is already the cgroup of the container, so base is
+// returned when the path does not exist below it.
+func cgroupDir(base, path string) string {
+	if path == "" || path == "/" {
+		return base
+	}
+	dir := filepath.Join(base, path)
+	if _, err := os.Stat(dir); err != nil {
+		return base
+	}
+	return dir
+}
+
+func (r cgroupReader) readV2(dir string) (cgroupStats, error) {
+	var s cgroupStats
+
+	// cpu.max is "<quota> <period>" or "max <period>"
+	if fields, err := readCgroupFields(filepath.Join(dir, "cpu.max")); err == nil && len(fields) == 2 && fields[0] != "max" {
+		quota, err1 := strconv.ParseFloat(fields[0], 64)
+		period, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 == nil && err2 == nil && period > 0 {
+			s.cpuQuota = quota / period
+		}
+	}
+
+	stat, err := readCgroupKeyValues(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return s, err
+	}
+	s.hasCPUStat = true
+	s.cpuUsage = stat["usage_usec"] / 1e6
+	s.cpuPeriods = stat["nr_periods"]
+	s.cpuThrottled = stat["nr_throttled"]
+	s.cpuThrottledTime = stat["throttled_usec"] / 1e6
+
+	if v, err := readCgroupValue(filepath.Join(dir, "memory.max")); err == nil {
+		s.memoryLimit = v
+	}
+	if v, err := readCgroupValue(filepath.Join(dir, "memory.current")); err == nil {
+		s.memoryUsage = v
+	}
+	if events, err := readCgroupKeyValues(filepath.Join(dir, "memory.events")); err == nil {
+		s.oomEvents = events["oom_kill"]
+		s.hasMemoryOOMCount = true
+	}
+	return s, nil
+}
+
+func (r cgroupReader) readV1(paths map[string]string) (cgroupStats, error) {
+	var s cgroupStats
+
+	cpuDir := r.v1Dir(paths, "cpu", "cpu,cpuacct")
+	acctDir := r.v1Dir(paths, "cpuacct", "cpu,cpuacct")
+	memDir := r.v1Dir(paths, "memory")
+
+	quota, err1 := readCgroupValue(filepath.Join(cpuDir, "cpu.cfs_quota_us"))
+	period, err2 := readCgroupValue(filepath.Join(cpuDir, "cpu.cfs_period_us"))
+	if err1 == nil && err2 == nil && quota > 0 && period > 0 {
+		s.cpuQuota = quota / period
+	}
+
+	usage, err := readCgroupValue(filepath.Join(acctDir, "cpuacct.usage"))
+	if err != nil {
+		return s, err
+	}
+	s.hasCPUStat = true
+	s.cpuUsage = usage / 1e9
+	if stat, err := readCgroupKeyValues(filepath.Join(cpuDir, "cpu.stat")); err == nil {
+		s.cpuPeriods = stat["nr_periods"]
+		s.cpuThrottled = stat["nr_throttled"]
+		s.cpuThrottledTime = stat["throttled_time"] / 1e9
+	}
+
+	if v, err := readCgroupValue(filepath.Join(memDir, "memory.limit_in_bytes")); err == nil {
+		s.memoryLimit = v
+	}
+	if v, err := readCgroupValue(filepath.Join(memDir, "memory.usage_in_bytes")); err == nil {
+		s.memoryUsage = v
+	}
+	if oom, err := readCgroupKeyValues(filepath.Join(memDir, "memory.oom_control")); err == nil {
+		if v, ok := oom["oom_kill"]; ok {
+			s.oomEvents = v
+			s.hasMemoryOOMCount = true
+		}
+	}
+	return s, nil
+}
+
+// v1Dir returns the process cgroup directory in the first existing controller hierarchy
+// among names.
+func (r cgroupReader) v1Dir(paths map[string]string, names ...string) string {
+	for _, n := range names {
+		base := filepath.Join(r.root, n)
+		if _, err := os.Stat(base); err == nil {
+			controller, _, _ := strings.Cut(n, ",")
+			return cgroupDir(base, paths[controller])
+		}
+	}
+	return filepath.Join(r.root, names[0])
+}
+
+func readCgroupFields(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(b)), nil
+}
+
+// readCgroupValue reads a file holding a single number. "max", and the huge values
+// cgroup v1 uses for no limit, are returned as zero.
+func readCgroupValue(path string) (float64, error) {
+	fields, err := readCgroupFields(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) == 0 {
+		return 0, errors.New("prometrics: empty cgroup file " + path)
+	}
+	if fields[0] == "max" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	if v >= 1<<62 {
+		return 0, nil
+	}
+	return v, nil
+}
+
+// readCgroupKeyValues reads a flat keyed file such as cpu.stat.
+func readCgroupKeyValues(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]float64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, sc.Err()
+}
+
+// WithCgroup exports container aware CPU and memory metrics read from the cgroup
+// (v1 or v2) at DefaultCgroupRoot. See WithCgroupRoot.
+func WithCgroup() HealthOption {
+	return WithCgroupRoot(DefaultCgroupRoot)
+}
+
+// WithCgroupRoot exports container aware CPU and memory metrics read from the cgroup
+// (v1 or v2) of the process, as listed in /proc/self/cgroup, in the hierarchy mounted
+// at root:
+//   - app_cgroup_cpu_quota_cores (absent when there is no CPU limit)
+//   - app_cgroup_cpu_usage_seconds_total
+//   - app_cgroup_cpu_periods_total
+//   - app_cgroup_cpu_throttled_periods_total
+//   - app_cgroup_cpu_throttled_seconds_total
+//   - app_cgroup_cpu_utilisation_ratio, CPU usage since the previous scrape relative to the quota
+//   - app_cgroup_memory_limit_bytes (absent when there is no memory limit)
+//   - app_cgroup_memory_usage_bytes
+//   - app_cgroup_memory_utilisation_ratio, memory usage relative to the limit
+//   - app_cgroup_oom_events_total
+//
+// Unlike app_cpu_usage_percent, which is relative to a host core, the utilisation ratios
+// are relative to what the container is allowed to use.
+func WithCgroupRoot(root string) HealthOption {
+	cg := newCgroupCollector(root)
+	return func(c *HealthCollector) {
+		c.addFamily(healthFamily{name: "cgroup", descs: cg.descs(), collect: cg.collect})
+	}
+}
+
+type cgroupCollector struct {
+	reader cgroupReader
+
+	cpuQuota         *prometheus.Desc
+	cpuUsage         *prometheus.Desc
+	cpuPeriods       *prometheus.Desc
+	cpuThrottled     *prometheus.Desc
+	cpuThrottledTime *prometheus.Desc
+	cpuUtilisation   *prometheus.Desc
+	memoryLimit      *prometheus.Desc
+	memoryUsage      *prometheus.Desc
+	memUtilisation   *prometheus.Desc
+	oomEvents        *prometheus.Desc
+
+	mu        sync.Mutex
+	lastUsage float64
+	lastTime  time.Time
+}
+
+func newCgroupCollector(root string) *cgroupCollector {
+	return &cgroupCollector{
+		reader:           cgroupReader{root: root, self: selfCgroupFile},
+		cpuQuota:         prometheus.NewDesc("app_cgroup_cpu_quota_cores", "CPU quota of the container in cores.", nil, nil),
+		cpuUsage:         prometheus.NewDesc("app_cgroup_cpu_usage_seconds_total", "Total CPU time consumed by the container in seconds.", nil, nil),
+		cpuPeriods:       prometheus.NewDesc("app_cgroup_cpu_periods_total", "Total CPU enforcement periods of the container.", nil, nil),
+		cpuThrottled:     prometheus.NewDesc("app_cgroup_cpu_throttled_periods_total", "Total CPU periods the container was throttled in.", nil, nil),
+		cpuThrottledTime: prometheus.NewDesc("app_cgroup_cpu_throttled_seconds_total", "Total time the container was throttled in seconds.", nil, nil),
+		cpuUtilisation:   prometheus.NewDesc("app_cgroup_cpu_utilisation_ratio", "CPU usage since the previous scrape relative to the container CPU quota.", nil, nil),
+		memoryLimit:      prometheus.NewDesc("app_cgroup_memory_limit_bytes", "Memory limit of the container in bytes.", nil, nil),
+		memoryUsage:      prometheus.NewDesc("app_cgroup_memory_usage_bytes", "Memory usage of the container in bytes.", nil, nil),
+		memUtilisation:   prometheus.NewDesc("app_cgroup_memory_utilisation_ratio", "Memory usage relative to the container memory limit.", nil, nil),
+		oomEvents:        prometheus.NewDesc("app_cgroup_oom_events_total", "Total OOM kills in the container.", nil, nil),
+	}
+}
+
+func (cg *cgroupCollector) descs() []*prometheus.Desc {
+	return []*prometheus.Desc{cg.cpuQuota, cg.cpuUsage, cg.cpuPeriods, cg.cpuThrottled, cg.cpuThrottledTime,
+		cg.cpuUtilisation, cg.memoryLimit, cg.memoryUsage, cg.memUtilisation, cg.oomEvents}
+}
+
+func (cg *cgroupCollector) collect(ch chan<- prometheus.Metric) error {
+	s, err := cg.reader.read()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	if s.cpuQuota > 0 {
+		ch <- prometheus.MustNewConstMetric(cg.cpuQuota, prometheus.GaugeValue, s.cpuQuota)
+	}
+	if s.hasCPUStat {
+		ch <- prometheus.MustNewConstMetric(cg.cpuUsage, prometheus.CounterValue, s.cpuUsage)
+		ch <- prometheus.MustNewConstMetric(cg.cpuPeriods, prometheus.CounterValue, s.cpuPeriods)
+		ch <- prometheus.MustNewConstMetric(cg.cpuThrottled, prometheus.CounterValue, s.cpuThrottled)
+		ch <- prometheus.MustNewConstMetric(cg.cpuThrottledTime, prometheus.CounterValue, s.cpuThrottledTime)
+	}
+	if s.memoryLimit > 0 {
+		ch <- prometheus.MustNewConstMetric(cg.memoryLimit, prometheus.GaugeValue, s.memoryLimit)
+		ch <- prometheus.MustNewConstMetric(cg.memUtilisation, prometheus.GaugeValue, s.memoryUsage/s.memoryLimit)
+	}
+	ch <- prometheus.MustNewConstMetric(cg.memoryUsage, prometheus.GaugeValue, s.memoryUsage)
+	if s.hasMemoryOOMCount {
+		ch <- prometheus.MustNewConstMetric(cg.oomEvents, prometheus.CounterValue, s.oomEvents)
+	}
+
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	if s.cpuQuota > 0 && !cg.lastTime.IsZero() && s.cpuUsage >= cg.lastUsage {
+		if elapsed := now.Sub(cg.lastTime).Seconds(); elapsed > 0 {
+			ratio := (s.cpuUsage - cg.lastUsage) / (elapsed * s.cpuQuota)
+			ch <- prometheus.MustNewConstMetric(cg.cpuUtilisation, prometheus.GaugeValue, ratio)
+		}
+	}
+	cg.lastUsage, cg.lastTime = s.cpuUsage, now
+	return nil
+}
@@ -0,0 +1,146 @@
+package prometrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func writeCgroupFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCgroupReaderV2(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers": "cpu memory\n",
+		"cpu.max":            "150000 100000\n",
+		"cpu.stat":           "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\nnr_periods 40\nnr_throttled 4\nthrottled_usec 300000\n",
+		"memory.max":         "536870912\n",
+		"memory.current":     "134217728\n",
+		"memory.events":      "low 0\nhigh 0\nmax 3\noom 2\noom_kill 1\n",
+	})
+
+	s, err := cgroupReader{root: root}.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cgroupStats{
+		cpuQuota: 1.5, cpuUsage: 2.5, cpuPeriods: 40, cpuThrottled: 4, cpuThrottledTime: 0.3,
+		memoryLimit: 536870912, memoryUsage: 134217728, oomEvents: 1, hasCPUStat: true, hasMemoryOOMCount: true,
+	}
+	if s != want {
+		t.Errorf("read() = %+v, want %+v", s, want)
+	}
+}
+
+func TestCgroupReaderV1Unlimited(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"cpu,cpuacct/cpu.cfs_quota_us":  "-1\n",
+		"cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+		"cpu,cpuacct/cpuacct.usage":     "7000000000\n",
+		"cpu,cpuacct/cpu.stat":          "nr_periods 0\nnr_throttled 0\nthrottled_time 0\n",
+		"memory/memory.limit_in_bytes":  "9223372036854771712\n",
+		"memory/memory.usage_in_bytes":  "1048576\n",
+		"memory/memory.oom_control":     "oom_kill_disable 0\nunder_oom 0\noom_kill 2\n",
+	})
+
+	s, err := cgroupReader{root: root}.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cgroupStats{cpuUsage: 7, memoryUsage: 1048576, oomEvents: 2, hasCPUStat: true, hasMemoryOOMCount: true}
+	if s != want {
+		t.Errorf("read() = %+v, want %+v", s, want)
+	}
+}
+
+func TestCgroupReaderResolvesProcessCgroup(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers":                      "cpu memory\n",
+		"cpu.stat":                                "usage_usec 9000000\n",
+		"memory.current":                          "999\n",
+		"system.slice/app.service/cpu.stat":       "usage_usec 2000000\n",
+		"system.slice/app.service/memory.current": "100\n",
+		"self": "0::/system.slice/app.service\n",
+	})
+
+	s, err := cgroupReader{root: root, self: filepath.Join(root, "self")}.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.cpuUsage != 2 || s.memoryUsage != 100 {
+		t.Errorf("read() = %+v, want the statistics of system.slice/app.service", s)
+	}
+
+	// a host path that does not exist below root, eg. in a container, falls back to root
+	writeCgroupFiles(t, root, map[string]string{"self": "0::/kubepods/pod1/abc\n"})
+	if s, err = (cgroupReader{root: root, self: filepath.Join(root, "self")}).read(); err != nil || s.cpuUsage != 9 {
+		t.Errorf("read() = %+v, %v, want the statistics of root", s, err)
+	}
+}
+
+func TestCgroupReaderV1ResolvesProcessCgroup(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"cpu,cpuacct/cpuacct.usage":        "1000000000\n",
+		"cpu,cpuacct/app/cpuacct.usage":    "3000000000\n",
+		"memory/memory.usage_in_bytes":     "999\n",
+		"memory/app/memory.usage_in_bytes": "42\n",
+		"self":                             "12:memory:/app\n4:cpu,cpuacct:/app\n1:name=systemd:/app\n",
+	})
+
+	s, err := cgroupReader{root: root, self: filepath.Join(root, "self")}.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.cpuUsage != 3 || s.memoryUsage != 42 {
+		t.Errorf("read() = %+v, want the statistics of /app", s)
+	}
+}
+
+func TestHealthCollectorCgroup(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers": "cpu memory\n",
+		"cpu.max":            "max 100000\n",
+		"cpu.stat":           "usage_usec 1000000\nnr_periods 0\nnr_throttled 0\nthrottled_usec 0\n",
+		"memory.max":         "1000\n",
+		"memory.current":     "250\n",
+	})
+
+	reg := prometheus.NewRegistry()
+	if err := RegisterHealthCollector(reg, WithCgroupRoot(root)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := testutil.GatherAndCount(reg, "app_cgroup_cpu_quota_cores"); err != nil || n != 0 {
+		t.Errorf("app_cgroup_cpu_quota_cores series = %d, %v, want 0 without a quota", n, err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == "app_cgroup_memory_utilisation_ratio" {
+			if got := mf.GetMetric()[0].GetGauge().GetValue(); got != 0.25 {
+				t.Errorf("memory utilisation = %v, want 0.25", got)
+			}
+			return
+		}
+	}
+	t.Error("app_cgroup_memory_utilisation_ratio not exported")
+}
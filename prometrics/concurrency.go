@@ -0,0 +1,353 @@
+package prometrics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// concurrencyBuckets go from 1µs to about 4s.
+var concurrencyBuckets = prometheus.ExponentialBuckets(0.000001, 4, 12)
+
+var (
+	// MutexWaitDuration tracks how long goroutines waited to acquire an instrumented mutex
+	// in seconds, labeled by mutex name and mode (lock, rlock). Uncontended acquisitions
+	// are observed as 0.
+	//
+	// Metric type: HistogramVec
+	MutexWaitDuration = CreateHistogram("mutex_wait_duration_seconds", "Time waited to acquire a mutex in seconds", []string{"mutex", "mode"}, concurrencyBuckets)
+	// MutexHoldDuration tracks how long an instrumented mutex was held in seconds, labeled by
+	// mutex name and mode. Only exclusive locks are observed.
+	//
+	// Metric type: HistogramVec
+	MutexHoldDuration = CreateHistogram("mutex_hold_duration_seconds", "Time a mutex was held in seconds", []string{"mutex", "mode"}, concurrencyBuckets)
+	// ChanBlockedSendsTotal counts the sends on an instrumented channel that had to wait
+	// because the channel was full, labeled by channel name.
+	//
+	// Metric type: CounterVec
+	ChanBlockedSendsTotal = CreateCounter("chan_blocked_sends_total", "Total channel sends that blocked", []string{"chan"})
+	// ChanSendWaitDuration tracks how long blocked sends waited in seconds, labeled by channel name.
+	//
+	// Metric type: HistogramVec
+	ChanSendWaitDuration = CreateHistogram("chan_send_wait_duration_seconds", "Time blocked channel sends waited in seconds", []string{"chan"}, concurrencyBuckets)
+)
+
+var concurrencyMetricsDisabled atomic.Bool
+
+// SetConcurrencyMetrics enables or disables the metrics of InstrumentedMutex,
+// InstrumentedRWMutex and InstrumentedChan. When disabled they behave like the plain
+// sync and channel primitives, at the cost of a single atomic load. They are enabled
+// by default.
+func SetConcurrencyMetrics(enabled bool) {
+	concurrencyMetricsDisabled.Store(!enabled)
+}
+
+// InstrumentedMutex is a sync.Mutex recording its wait and hold times. The zero value is
+// an unnamed mutex that records nothing, use NewInstrumentedMutex.
+type InstrumentedMutex struct {
+	mu       sync.Mutex
+	wait     prometheus.Observer
+	hold     prometheus.Observer
+	lockedAt time.Time
+}
+
+// NewInstrumentedMutex creates an InstrumentedMutex recorded under name.
+//
+// Example:
+//
+//	var personMux = prometrics.NewInstrumentedMutex("person")
+//
+//	personMux.Lock()
+//	defer personMux.Unlock()
+func NewInstrumentedMutex(name string) *InstrumentedMutex {
+	return &InstrumentedMutex{
+		wait: MutexWaitDuration.WithLabelValues(name, "lock"),
+		hold: MutexHoldDuration.WithLabelValues(name, "lock"),
+	}
+}
+
+// Lock locks m, see sync.Mutex.
+func (m *InstrumentedMutex) Lock() {
+	if m.wait == nil || concurrencyMetricsDisabled.Load() {
+		m.mu.Lock()
+		m.lockedAt = time.Time{}
+		return
+	}
+	m.lockedAt = lockTimed(&m.mu, m.wait)
+}
+
+// TryLock tries to lock m, see sync.Mutex.
+func (m *InstrumentedMutex) TryLock() bool {
+	if !m.mu.TryLock() {
+		return false
+	}
+	m.lockedAt = time.Time{}
+	if m.hold != nil && !concurrencyMetricsDisabled.Load() {
+		m.lockedAt = time.Now()
+	}
+	return true
+}
+
+// Unlock unlocks m, see sync.Mutex.
+func (m *InstrumentedMutex) Unlock() {
+	if !m.lockedAt.IsZero() {
+		m.hold.Observe(time.Since(m.lockedAt).Seconds())
+	}
+	m.mu.Unlock()
+}
+
+// InstrumentedRWMutex is a sync.RWMutex recording its wait times, and the hold time of
+// its write lock. The zero value is an unnamed mutex that records nothing, use
+// NewInstrumentedRWMutex.
+type InstrumentedRWMutex struct {
+	mu       sync.RWMutex
+	wait     prometheus.Observer
+	rwait    prometheus.Observer
+	hold     prometheus.Observer
+	lockedAt time.Time
+}
+
+// NewInstrumentedRWMutex creates an InstrumentedRWMutex recorded under name.
+func NewInstrumentedRWMutex(name string) *InstrumentedRWMutex {
+	return &InstrumentedRWMutex{
+		wait:  MutexWaitDuration.WithLabelValues(name, "lock"),
+		rwait: MutexWaitDuration.WithLabelValues(name, "rlock"),
+		hold:  MutexHoldDuration.WithLabelValues(name, "lock"),
+	}
+}
+
+// Lock locks m for writing, see sync.RWMutex.
+func (m *InstrumentedRWMutex) Lock() {
+	if m.wait == nil || concurrencyMetricsDisabled.Load() {
+		m.mu.Lock()
+		m.lockedAt = time.Time{}
+		return
+	}
+	m.lockedAt = lockTimed(&m.mu, m.wait)
+}
+
+// Unlock unlocks m for writing, see sync.RWMutex.
+func (m *InstrumentedRWMutex) Unlock() {
+	if !m.lockedAt.IsZero() {
+		m.hold.Observe(time.Since(m.lockedAt).Seconds())
+	}
+	m.mu.Unlock()
+}
+
+// RLock locks m for reading, see sync.RWMutex. Read locks are held concurrently, so
+// only their wait time is recorded.
+func (m *InstrumentedRWMutex) RLock() {
+	if m.rwait == nil || concurrencyMetricsDisabled.Load() {
+		m.mu.RLock()
+		return
+	}
+	if m.mu.TryRLock() {
+		m.rwait.Observe(0)
+		return
+	}
+	start := time.Now()
+	m.mu.RLock()
+	m.rwait.Observe(time.Since(start).Seconds())
+}
+
+// RUnlock undoes a single RLock call, see sync.RWMutex.
+func (m *InstrumentedRWMutex) RUnlock() { m.mu.RUnlock() }
+
+// lockTimed locks mu, observes the wait in wait and returns the time the lock was acquired.
+// An uncontended lock does not read the clock for the wait.
+func lockTimed(mu interface {
+	Lock()
+	TryLock() bool
+}, wait prometheus.Observer) time.Time {
+	if mu.TryLock() {
+		wait.Observe(0)
+		return time.Now()
+	}
+	start := time.Now()
+	mu.Lock()
+	now := time.Now()
+	wait.Observe(now.Sub(start).Seconds())
+	return now
+}
+
+// InstrumentedChan is a buffered channel recording blocked sends, exporting its length
+// and capacity at scrape time:
+//   - chan_length{chan}, chan_capacity{chan}
+//   - chan_blocked_sends_total{chan}, chan_send_wait_duration_seconds{chan}
+//
+// Values are received from C, directly or with Recv, so the channel can still be used in
+// select statements and range loops.
+type InstrumentedChan[T any] struct {
+	c       chan T
+	name    string
+	blocked prometheus.Counter
+	wait    prometheus.Observer
+}
+
+// NewInstrumentedChan creates an InstrumentedChan with a buffer of size, recorded under
+// name. Close it with Close so its length and capacity are not exported anymore.
+//
+// Example:
+//
+//	events := prometrics.NewInstrumentedChan[Event]("events", 128)
+//	go func() {
+//	    for e := range events.C() {
+//	        handle(e)
+//	    }
+//	}()
+//	events.Send(Event{})
+func NewInstrumentedChan[T any](name string, size int) *InstrumentedChan[T] {
+	c := &InstrumentedChan[T]{
+		c:       make(chan T, size),
+		name:    name,
+		blocked: ChanBlockedSendsTotal.WithLabelValues(name),
+		wait:    ChanSendWaitDuration.WithLabelValues(name),
+	}
+	chanSizes.add(name, c)
+	return c
+}
+
+// C returns the channel to receive from.
+func (c *InstrumentedChan[T]) C() <-chan T { return c.c }
+
+// Len returns the number of values queued in the channel.
+func (c *InstrumentedChan[T]) Len() int { return len(c.c) }
+
+// Cap returns the capacity of the channel.
+func (c *InstrumentedChan[T]) Cap() int { return cap(c.c) }
+
+// Send sends v, blocking while the channel is full.
+func (c *InstrumentedChan[T]) Send(v T) {
+	_ = c.SendContext(context.Background(), v)
+}
+
+// SendContext sends v, blocking while the channel is full until ctx is done.
+func (c *InstrumentedChan[T]) SendContext(ctx context.Context, v T) error {
+	if concurrencyMetricsDisabled.Load() {
+		select {
+		case c.c <- v:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case c.c <- v:
+		return nil
+	default:
+	}
+
+	c.blocked.Inc()
+	start := time.Now()
+	defer func() { c.wait.Observe(time.Since(start).Seconds()) }()
+	select {
+	case c.c <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TrySend sends v if the channel is not full and reports whether it did.
+func (c *InstrumentedChan[T]) TrySend(v T) bool {
+	select {
+	case c.c <- v:
+		return true
+	default:
+		return false
+	}
+}
+
+// Recv receives a value, ok is false once the channel is closed and drained.
+func (c *InstrumentedChan[T]) Recv() (v T, ok bool) {
+	v, ok = <-c.c
+	return v, ok
+}
+
+// Close closes the channel and stops exporting its length and capacity.
+func (c *InstrumentedChan[T]) Close() {
+	chanSizes.remove(c.name, c)
+	close(c.c)
+}
+
+type sizedChan interface {
+	Len() int
+	Cap() int
+}
+
+// chanSizeCollector is a prometheus.Collector exporting the length and capacity of the
+// open instrumented channels. Channels sharing a name are summed up.
+type chanSizeCollector struct {
+	length   *prometheus.Desc
+	capacity *prometheus.Desc
+
+	registered sync.Once
+	mu         sync.Mutex
+	chans      map[string][]sizedChan
+}
+
+var chanSizes = &chanSizeCollector{
+	length:   prometheus.NewDesc("chan_length", "Number of values queued in the channel", []string{"chan"}, nil),
+	capacity: prometheus.NewDesc("chan_capacity", "Capacity of the channel", []string{"chan"}, nil),
+	chans:    make(map[string][]sizedChan),
+}
+
+func (cc *chanSizeCollector) add(name string, c sizedChan) {
+	cc.registered.Do(func() {
+		if err := prometheus.DefaultRegisterer.Register(cc); err != nil {
+			logger().Error("channel collector registration failed", "error", err)
+		}
+	})
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.chans[name] = append(cc.chans[name], c)
+}
+
+func (cc *chanSizeCollector) remove(name string, c sizedChan) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	chans := cc.chans[name]
+	for i, other := range chans {
+		if other == c {
+			chans = append(chans[:i], chans[i+1:]...)
+			break
+		}
+	}
+	if len(chans) == 0 {
+		delete(cc.chans, name)
+	} else {
+		cc.chans[name] = chans
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (cc *chanSizeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.length
+	ch <- cc.capacity
+}
+
+// Collect implements prometheus.Collector.
+func (cc *chanSizeCollector) Collect(ch chan<- prometheus.Metric) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	names := make([]string, 0, len(cc.chans))
+	for name := range cc.chans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var length, capacity int
+		for _, c := range cc.chans[name] {
+			length += c.Len()
+			capacity += c.Cap()
+		}
+		ch <- prometheus.MustNewConstMetric(cc.length, prometheus.GaugeValue, float64(length), name)
+		ch <- prometheus.MustNewConstMetric(cc.capacity, prometheus.GaugeValue, float64(capacity), name)
+	}
+}
@@ -0,0 +1,149 @@
+package prometrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestInstrumentedMutex(t *testing.T) {
+	name := uniqueTestName("test-mutex")
+	m := NewInstrumentedMutex(name)
+
+	m.Lock()
+	acquired := make(chan struct{})
+	go func() {
+		m.Lock()
+		close(acquired)
+		m.Unlock()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	m.Unlock()
+	<-acquired
+
+	waits := histogramFor(t, MutexWaitDuration, name, "lock")
+	if waits.GetSampleCount() != 2 {
+		t.Errorf("wait count = %d, want 2", waits.GetSampleCount())
+	}
+	if waits.GetSampleSum() < 0.01 {
+		t.Errorf("wait sum = %v, want the contended lock to have waited", waits.GetSampleSum())
+	}
+	holds := histogramFor(t, MutexHoldDuration, name, "lock")
+	if holds.GetSampleCount() != 2 || holds.GetSampleSum() < 0.01 {
+		t.Errorf("hold count = %d sum = %v, want 2 holds of at least 10ms", holds.GetSampleCount(), holds.GetSampleSum())
+	}
+}
+
+func TestInstrumentedRWMutex(t *testing.T) {
+	name := uniqueTestName("test-rwmutex")
+	m := NewInstrumentedRWMutex(name)
+
+	m.RLock()
+	m.RLock()
+	m.RUnlock()
+	m.RUnlock()
+	m.Lock()
+	m.Unlock()
+
+	if n := histogramFor(t, MutexWaitDuration, name, "rlock").GetSampleCount(); n != 2 {
+		t.Errorf("rlock wait count = %d, want 2", n)
+	}
+	if n := histogramFor(t, MutexWaitDuration, name, "lock").GetSampleCount(); n != 1 {
+		t.Errorf("lock wait count = %d, want 1", n)
+	}
+	if n := histogramFor(t, MutexHoldDuration, name, "lock").GetSampleCount(); n != 1 {
+		t.Errorf("hold count = %d, want 1", n)
+	}
+}
+
+func TestConcurrencyMetricsDisabled(t *testing.T) {
+	name := uniqueTestName("test-mutex-disabled")
+	SetConcurrencyMetrics(false)
+	defer SetConcurrencyMetrics(true)
+
+	m := NewInstrumentedMutex(name)
+	m.Lock()
+	m.Unlock()
+	c := NewInstrumentedChan[int](name, 0)
+	defer c.Close()
+	go c.Send(1)
+	<-c.C()
+
+	if n := histogramFor(t, MutexWaitDuration, name, "lock").GetSampleCount(); n != 0 {
+		t.Errorf("wait count = %d, want nothing recorded while disabled", n)
+	}
+	if n := testutil.ToFloat64(ChanBlockedSendsTotal.WithLabelValues(name)); n != 0 {
+		t.Errorf("blocked sends = %v, want nothing recorded while disabled", n)
+	}
+}
+
+func TestInstrumentedChan(t *testing.T) {
+	name := uniqueTestName("test-chan")
+	c := NewInstrumentedChan[int](name, 2)
+
+	c.Send(1)
+	if !c.TrySend(2) {
+		t.Fatal("TrySend failed on a channel with room")
+	}
+	if c.TrySend(3) {
+		t.Fatal("TrySend succeeded on a full channel")
+	}
+
+	expected := fmt.Sprintf(`
+# HELP chan_capacity Capacity of the channel
+# TYPE chan_capacity gauge
+chan_capacity{chan=%[1]q} 2
+# HELP chan_length Number of values queued in the channel
+# TYPE chan_length gauge
+chan_length{chan=%[1]q} 2
+`, name)
+	if err := testutil.CollectAndCompare(chanSizes, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.SendContext(ctx, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SendContext on a full channel = %v, want deadline exceeded", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c.Recv()
+	}()
+	c.Send(3)
+
+	if n := testutil.ToFloat64(ChanBlockedSendsTotal.WithLabelValues(name)); n != 2 {
+		t.Errorf("blocked sends = %v, want 2", n)
+	}
+	if n := histogramFor(t, ChanSendWaitDuration, name).GetSampleCount(); n != 2 {
+		t.Errorf("send wait count = %d, want 2", n)
+	}
+
+	c.Close()
+	if n := testutil.CollectAndCount(chanSizes); n != 0 {
+		t.Errorf("collected %d series after Close, want 0", n)
+	}
+	for _, want := range []int{2, 3} {
+		if v, ok := c.Recv(); !ok || v != want {
+			t.Errorf("Recv() = %d, %v, want %d, true", v, ok, want)
+		}
+	}
+}
+
+// histogramFor returns the histogram of vec for the label values.
+func histogramFor(t *testing.T, vec *prometheus.HistogramVec, lvs ...string) *dto.Histogram {
+	t.Helper()
+	var pb dto.Metric
+	if err := vec.WithLabelValues(lvs...).(prometheus.Metric).Write(&pb); err != nil {
+		t.Fatal(err)
+	}
+	return pb.GetHistogram()
+}
@@ -0,0 +1,70 @@
+package prometrics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// CrudBatchSize tracks the number of items of batch CRUD operations, labeled by
+	// object type and operation name.
+	//
+	// Metric type: HistogramVec
+	CrudBatchSize = CreateHistogram("crud_batch_size", "Number of items of batch CRUD operations", []string{"object", "operation"}, prometheus.ExponentialBuckets(1, 4, 8))
+	// CrudBatchItems counts the items of batch CRUD operations, labeled by object type,
+	// operation name and result (succeeded, failed).
+	//
+	// Metric type: CounterVec
+	CrudBatchItems = CreateCounter("crud_batch_items_total", "Total items of batch CRUD operations", []string{"object", "operation", "result"})
+)
+
+// TrackCRUDBatch records metrics for a batch CRUD operation on size items, eg. a bulk
+// insert. The returned function takes the number of items that succeeded and the error of
+// the operation, if any; the other items count as failed:
+//
+//	done := prometrics.TrackCRUDBatch("person", "create", len(people))
+//	n, err := repo.InsertMany(ctx, people)
+//	done(n, err)
+//
+// Besides crud_operations_total and the duration, recorded once for the batch, the batch
+// size goes to crud_batch_size and the items to crud_batch_items_total. The outcome is
+// partial when only some items succeeded, otherwise it is the class of err, so a batch
+// whose items all succeeded but which returned an error, eg. a failed commit, is not
+// recorded as a success. Without an error it is success, or error when every item failed.
+//
+// For "create" and "delete" operations object_count is moved by the number of succeeded
+// items, unless the object count comes from RegisterObjectCounter.
+func TrackCRUDBatch(object, operation string, size int) func(succeeded int, err error) {
+	start := time.Now()
+	return func(succeeded int, err error) {
+		succeeded = min(max(succeeded, 0), size)
+		failed := size - succeeded
+
+		outcome := OutcomeSuccess
+		switch {
+		case succeeded > 0 && failed > 0:
+			outcome = OutcomePartial
+		case err != nil:
+			outcome = classifyError(err)
+		case failed > 0:
+			outcome = OutcomeError
+		}
+		recordCRUD(object, operation, start, outcome)
+
+		CrudBatchSize.WithLabelValues(object, operation).Observe(float64(size))
+		CrudBatchItems.WithLabelValues(object, operation, "succeeded").Add(float64(succeeded))
+		CrudBatchItems.WithLabelValues(object, operation, "failed").Add(float64(failed))
+
+		if succeeded == 0 {
+			return
+		}
+		switch strings.ToLower(operation) {
+		case "create":
+			updateObjectCount(object, func(g prometheus.Gauge) { g.Add(float64(succeeded)) })
+		case "delete":
+			updateObjectCount(object, func(g prometheus.Gauge) { g.Sub(float64(succeeded)) })
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package prometrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTrackCRUDBatch(t *testing.T) {
+	order := uniqueTestName("test-order")
+	SetObjectCount(order, 10)
+
+	TrackCRUDBatch(order, "create", 5)(5, nil)
+	TrackCRUDBatch(order, "create", 4)(3, errors.New("duplicate key"))
+	TrackCRUDBatch(order, "Delete", 2)(2, nil)
+	TrackCRUDBatch(order, "update", 3)(0, errors.New("connection refused"))
+	TrackCRUDBatch(order, "upsert", 2)(2, errors.New("commit failed"))
+
+	if got := testutil.ToFloat64(CrudObjectCount.WithLabelValues(order)); got != 16 {
+		t.Errorf("object_count = %v, want 10+5+3-2 = 16", got)
+	}
+	if got := testutil.ToFloat64(CrudBatchItems.WithLabelValues(order, "create", "succeeded")); got != 8 {
+		t.Errorf("items{create,succeeded} = %v, want 8", got)
+	}
+	if got := testutil.ToFloat64(CrudBatchItems.WithLabelValues(order, "create", "failed")); got != 1 {
+		t.Errorf("items{create,failed} = %v, want 1", got)
+	}
+	for _, c := range []struct {
+		operation, outcome string
+	}{
+		{"create", OutcomeSuccess},
+		{"create", OutcomePartial},
+		{"update", OutcomeError},
+		{"upsert", OutcomeError},
+	} {
+		if got := testutil.ToFloat64(CrudOperationTotal.WithLabelValues(order, c.operation, c.outcome)); got != 1 {
+			t.Errorf("operations{%s,%s} = %v, want 1", c.operation, c.outcome, got)
+		}
+	}
+	if got := testutil.ToFloat64(CrudOperationErrors.WithLabelValues(order, "create", OutcomePartial)); got != 1 {
+		t.Errorf("errors{create,partial} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(CrudOperationTotal.WithLabelValues(order, "upsert", OutcomePartial)); got != 0 {
+		t.Errorf("operations{upsert,partial} = %v, want 0 when every item succeeded", got)
+	}
+}
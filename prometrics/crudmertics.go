@@ -1,24 +1,113 @@
 package prometrics
 
-import "time"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 var (
 	// CrudOperationTotal counts the total number of CRUD operations, labeled by
-	// object type and operation name (e.g. "person", "create").
+	// object type, operation name (e.g. "person", "create") and outcome
+	// (success, error, not_found, conflict).
 	//
 	// Metric type: CounterVec
-	CrudOperationTotal = CreateCounter("crud_operations_total", "Total CRUD operations", []string{"object", "operation"})
+	CrudOperationTotal = CreateCounter("crud_operations_total", "Total CRUD operations", []string{"object", "operation", "outcome"})
 	// CrudOperationDuration tracks the duration of CRUD operations in seconds,
 	// labeled by object type and operation name.
 	//
 	// Metric type: HistogramVec
 	CrudOperationDuration = CreateHistogram("object_operation_duration_seconds", "CRUD duration", []string{"object", "operation"}, nil)
+	// CrudOperationErrors counts the failed CRUD operations, labeled by object type,
+	// operation name and error class as returned by the ErrorClassifier.
+	//
+	// Metric type: CounterVec
+	CrudOperationErrors = CreateCounter("crud_operation_errors_total", "Total failed CRUD operations by error class", []string{"object", "operation", "class"})
 	// CrudObjectCount reports the current number of objects of each type.
 	//
 	// Metric type: GaugeVec
 	CrudObjectCount = CreateGauge("object_count", "Current number of objects", []string{"object"})
 )
 
+// Outcomes of a CRUD operation, the values of the outcome label of crud_operations_total.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeError    = "error"
+	OutcomeNotFound = "not_found"
+	OutcomeConflict = "conflict"
+	// OutcomePartial is the outcome of a batch operation where some items failed.
+	OutcomePartial = "partial"
+)
+
+// ErrorClassifier maps the error returned by a CRUD operation to its outcome. It is only
+// called with non nil errors and should return one of the Outcome constants, or another
+// value from a small fixed set as it becomes a label value.
+type ErrorClassifier func(err error) string
+
+var errorClassifier atomic.Pointer[ErrorClassifier]
+
+// SetErrorClassifier replaces the ErrorClassifier used by the CRUD tracking functions,
+// eg. to recognise the not found and conflict errors of a database driver or an ORM.
+// Passing nil restores DefaultErrorClassifier.
+//
+// Example:
+//
+//	prometrics.SetErrorClassifier(func(err error) string {
+//	    if errors.Is(err, gorm.ErrRecordNotFound) {
+//	        return prometrics.OutcomeNotFound
+//	    }
+//	    return prometrics.DefaultErrorClassifier(err)
+//	})
+func SetErrorClassifier(classify ErrorClassifier) {
+	if classify == nil {
+		errorClassifier.Store(nil)
+		return
+	}
+	errorClassifier.Store(&classify)
+}
+
+// DefaultErrorClassifier classifies sql.ErrNoRows and fs.ErrNotExist as not_found,
+// fs.ErrExist as conflict and every other error as error.
+func DefaultErrorClassifier(err error) string {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, fs.ErrNotExist):
+		return OutcomeNotFound
+	case errors.Is(err, fs.ErrExist):
+		return OutcomeConflict
+	default:
+		return OutcomeError
+	}
+}
+
+func classifyError(err error) string {
+	if err == nil {
+		return OutcomeSuccess
+	}
+	if classify := errorClassifier.Load(); classify != nil {
+		return (*classify)(err)
+	}
+	return DefaultErrorClassifier(err)
+}
+
+// observeCRUD records a CRUD operation that started at start and ended with err.
+func observeCRUD(object, operation string, start time.Time, err error) {
+	recordCRUD(object, operation, start, classifyError(err))
+}
+
+// recordCRUD records a CRUD operation that started at start and ended with outcome.
+func recordCRUD(object, operation string, start time.Time, outcome string) {
+	CrudOperationTotal.WithLabelValues(object, operation, outcome).Inc()
+	CrudOperationDuration.WithLabelValues(object, operation).Observe(time.Since(start).Seconds())
+	if outcome != OutcomeSuccess {
+		CrudOperationErrors.WithLabelValues(object, operation, outcome).Inc()
+	}
+}
+
 // TrackCRUD records metrics for a CRUD operation. It should be called
 // immediately before and after performing an operation.
 //
@@ -27,24 +116,69 @@ var (
 //	done := metrics.TrackCRUD("person", "create")
 //	defer done(time.Now())
 //
-// The returned function observes the operation duration and increments
-// the total CRUD counter.
+// The returned function observes the operation duration, measured from start or from
+// the call to TrackCRUD if start is zero, and counts the operation as a success.
+// Use TrackCRUDErr or TrackCRUDFunc to record failed operations.
 func TrackCRUD(object, operation string) func(start time.Time) {
+	tracked := time.Now()
+	return func(start time.Time) {
+		if start.IsZero() {
+			start = tracked
+		}
+		observeCRUD(object, operation, start, nil)
+	}
+}
+
+// TrackCRUDErr records metrics for a CRUD operation that may fail. The returned function
+// takes a pointer to the error of the operation, so it can be deferred with a named
+// error result:
+//
+//	func (r *Repo) Create(p Person) (err error) {
+//	    defer prometrics.TrackCRUDErr("person", "create")(&err)
+//	    ...
+//	}
+//
+// The outcome label is set by the ErrorClassifier and failures are also counted in
+// crud_operation_errors_total. A nil pointer counts as a success.
+func TrackCRUDErr(object, operation string) func(err *error) {
 	start := time.Now()
-	return func(_ time.Time) {
-		elapsed := time.Since(start).Seconds()
-		CrudOperationTotal.WithLabelValues(object, operation).Inc()
-		CrudOperationDuration.WithLabelValues(object, operation).Observe(elapsed)
+	return func(errp *error) {
+		var err error
+		if errp != nil {
+			err = *errp
+		}
+		observeCRUD(object, operation, start, err)
 	}
 }
 
+// TrackCRUDFunc runs fn as a CRUD operation on object and records its duration and outcome.
+//
+// Example:
+//
+//	person, err := prometrics.TrackCRUDFunc(ctx, "person", "get", func(ctx context.Context) (*Person, error) {
+//	    return repo.Get(ctx, id)
+//	})
+func TrackCRUDFunc[T any](ctx context.Context, object, operation string, fn func(ctx context.Context) (T, error)) (T, error) {
+	start := time.Now()
+	v, err := fn(ctx)
+	observeCRUD(object, operation, start, err)
+	return v, err
+}
+
 // SetObjectCount sets the gauge for the given object type to a specific value.
+// It does nothing for an object whose count comes from RegisterObjectCounter.
 func SetObjectCount(object string, count float64) {
-	CrudObjectCount.WithLabelValues(object).Set(count)
+	updateObjectCount(object, func(g prometheus.Gauge) { g.Set(count) })
 }
 
 // IncObjectCount increments the gauge for the given object type by 1.
-func IncObjectCount(object string) { CrudObjectCount.WithLabelValues(object).Inc() }
+// It does nothing for an object whose count comes from RegisterObjectCounter.
+func IncObjectCount(object string) {
+	updateObjectCount(object, prometheus.Gauge.Inc)
+}
 
 // DecObjectCount decrements the gauge for the given object type by 1.
-func DecObjectCount(object string) { CrudObjectCount.WithLabelValues(object).Dec() }
+// It does nothing for an object whose count comes from RegisterObjectCounter.
+func DecObjectCount(object string) {
+	updateObjectCount(object, prometheus.Gauge.Dec)
+}
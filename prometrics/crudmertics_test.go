@@ -0,0 +1,42 @@
+package prometrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var errTestConflict = errors.New("duplicate key")
+
+func TestTrackCRUDErr(t *testing.T) {
+	account := uniqueTestName("test-account")
+	create := func(err error) (out error) {
+		defer TrackCRUDErr(account, "create")(&out)
+		return err
+	}
+
+	SetErrorClassifier(func(err error) string {
+		if errors.Is(err, errTestConflict) {
+			return OutcomeConflict
+		}
+		return DefaultErrorClassifier(err)
+	})
+	defer SetErrorClassifier(nil)
+
+	create(nil)
+	create(errTestConflict)
+	create(errors.New("connection refused"))
+
+	for outcome, want := range map[string]float64{OutcomeSuccess: 1, OutcomeConflict: 1, OutcomeError: 1} {
+		if got := testutil.ToFloat64(CrudOperationTotal.WithLabelValues(account, "create", outcome)); got != want {
+			t.Errorf("operations{%s} = %v, want %v", outcome, got, want)
+		}
+	}
+	if got := testutil.ToFloat64(CrudOperationErrors.WithLabelValues(account, "create", OutcomeConflict)); got != 1 {
+		t.Errorf("errors{conflict} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(CrudOperationErrors.WithLabelValues(account, "create", OutcomeError)); got != 1 {
+		t.Errorf("errors{error} = %v, want 1", got)
+	}
+}
@@ -41,6 +41,17 @@
 //   - http_request_size_bytes{path,method,code}
 //   - http_response_size_bytes{path,method,code}
 //
+// Long-lived streams (WebSocket upgrades, server-sent events, hijacked connections) are
+// detected by the middlewares and recorded in their own metrics instead of the request
+// duration histogram, see Stream:
+//   - http_streams_active{path,kind}
+//   - http_stream_duration_seconds{path,kind}
+//   - http_stream_messages_total{path,kind,direction}
+//   - http_stream_bytes_total{path,kind,direction}
+//
+// Optional HTTP metrics, enabled through HttpOption values:
+//   - http_request_queue_duration_seconds{path} (WithQueueTime)
+//
 // Additionally, application-level gauges or counters can be created dynamically
 // using the MetricFactory API for business metrics.
 package prometrics
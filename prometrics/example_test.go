@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/peek8/prometric-go/prometrics"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 // ExampleInstrumentHttpHandler demonstrates how to instrument a standard net/http handler
@@ -30,6 +32,29 @@ func ExampleInstrumentHttpHandler() {
 	// Response Code: 200
 }
 
+// ExampleWithStatusClass demonstrates how to record status code classes, non-standard
+// methods being collapsed into OTHER.
+func ExampleWithStatusClass() {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	instrumented := prometrics.InstrumentHttpHandler("class_handler", handler,
+		prometrics.WithStatusClass(),
+	)
+
+	for _, method := range []string{"GET", "PROPFIND"} {
+		req := httptest.NewRequest(method, "http://example.com/missing", nil)
+		instrumented.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	fmt.Println("4xx GET:", testutil.ToFloat64(prometrics.HttpRequestsTotal.WithLabelValues("class_handler", "get", "4xx")))
+	fmt.Println("4xx OTHER:", testutil.ToFloat64(prometrics.HttpRequestsTotal.WithLabelValues("class_handler", prometrics.MethodOther, "4xx")))
+	// Output:
+	// 4xx GET: 1
+	// 4xx OTHER: 1
+}
+
 // HealthMiddleware demonstrates how to register runtime metrics
 // (goroutines, GC stats, memory usage, etc.) using HealthMiddleware.
 func ExampleHealthMiddleware() {
@@ -49,6 +74,39 @@ func ExampleHealthMiddleware() {
 	// Health endpoint responded: OK
 }
 
+// ExampleRegisterHealthCollector demonstrates how to expose the application health
+// metrics from a custom registry. The values are computed at scrape time.
+func ExampleRegisterHealthCollector() {
+	reg := prometheus.NewRegistry()
+	if err := prometrics.RegisterHealthCollector(reg); err != nil {
+		fmt.Println("register:", err)
+		return
+	}
+
+	families, _ := reg.Gather()
+	for _, mf := range families {
+		fmt.Println(mf.GetName(), mf.GetType())
+	}
+	// Output:
+	// app_allocated_memory GAUGE
+	// app_cpu_usage_percent GAUGE
+	// app_garbage_collections_count COUNTER
+	// app_go_routines GAUGE
+	// app_uptime_seconds GAUGE
+}
+
+// ExampleSetBuildInfo demonstrates how to override the build information exported
+// in app_build_info, which is otherwise read from the binary at startup.
+func ExampleSetBuildInfo() {
+	info := prometrics.ReadBuildInfo()
+	info.Version = "1.4.2"
+	prometrics.SetBuildInfo(info)
+
+	fmt.Println("Build info series:", testutil.CollectAndCount(prometrics.AppBuildInfo))
+	// Output:
+	// Build info series: 1
+}
+
 // ExampleTrackCRUD desmonstrates how to use TrackCRUD function to track crud operation
 // total and crud operation duration
 func ExampleTrackCRUD() {
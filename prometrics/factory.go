@@ -39,8 +39,8 @@ var factory = &MetricFactory{
 //
 // Example:
 //
-//	counter := CreateCounter("crud_operations_total", "Total CRUD operations", []string{"object", "operation"})
-//	CrudOperationTotal.WithLabelValues("person", "create").Inc()
+//	counter := CreateCounter("crud_operations_total", "Total CRUD operations", []string{"object", "operation", "outcome"})
+//	counter.WithLabelValues("person", "create", "success").Inc()
 func CreateCounter(name, help string, labels []string) *prometheus.CounterVec {
 	factory.mu.Lock()
 	defer factory.mu.Unlock()
@@ -1,44 +1,113 @@
 package prometrics
 
 import (
+	"bufio"
+	"net"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func GinMiddleware() gin.HandlerFunc {
+// GinMiddleware records the HTTP metrics for every request served by gin.
+// It accepts the same HttpOption values as InstrumentHttpHandler.
+func GinMiddleware(opts ...HttpOption) gin.HandlerFunc {
+	cfg := newHttpConfig(opts)
 	return func(c *gin.Context) {
-		start := time.Now()
 		handler := c.FullPath()
+		weight, ok := cfg.sample(handler, c.Request)
+		if !ok {
+			c.Next()
+			return
+		}
 
-		HttpRequestsInFlight.WithLabelValues(handler).Inc()
-		defer HttpRequestsInFlight.WithLabelValues(handler).Dec()
+		start := time.Now()
+		HttpRequestsInFlight.WithLabelValues(handler).Add(weight)
+		defer HttpRequestsInFlight.WithLabelValues(handler).Sub(weight)
 
 		reqLength := c.Request.ContentLength
 
-		c.Next()
-
-		status := strconv.Itoa(c.Writer.Status())
-		duration := time.Since(start).Seconds()
-
 		if handler == "" {
 			handler = "unknown"
 		}
 
-		if reqLength > 0 {
-			HttpRequestSize.WithLabelValues(handler, c.Request.Method, status).Observe(float64(reqLength))
+		stream := newRequestStream(handler, c.Request, start)
+		c.Request = stream.withContext(c.Request)
+		c.Writer = &ginResponseWriter{ResponseWriter: c.Writer, stream: stream}
+
+		c.Next()
+
+		cfg.observeQueueTime(handler, c.Request, start)
+
+		if reqLength <= 0 {
+			reqLength = -1
+		}
+		respSize := int64(c.Writer.Size())
+		if respSize < 0 {
+			respSize = 0
 		}
 
-		HttpRequestsTotal.WithLabelValues(handler, c.Request.Method, status).Inc()
-		HttpRequestDuration.WithLabelValues(handler, c.Request.Method, status).Observe(duration)
-		HttpResponseSize.WithLabelValues(handler, c.Request.Method, status).Observe(float64(c.Writer.Size()))
+		cfg.recordRequest(&httpObservation{
+			request:  c.Request,
+			path:     handler,
+			method:   c.Request.Method,
+			code:     strconv.Itoa(c.Writer.Status()),
+			elapsed:  time.Since(start),
+			reqSize:  reqLength,
+			respSize: respSize,
+			stream:   stream,
+			weight:   weight,
+		})
+	}
+}
+
+// ginResponseWriter detects streaming responses written through gin, the same way
+// responseWriter does for net/http.
+type ginResponseWriter struct {
+	gin.ResponseWriter
+	stream *Stream
+}
+
+func (w *ginResponseWriter) detect() {
+	if !w.ResponseWriter.Written() {
+		w.stream.detectResponse(w.Header())
+	}
+}
+
+func (w *ginResponseWriter) WriteHeaderNow() {
+	w.detect()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *ginResponseWriter) Write(b []byte) (int, error) {
+	w.detect()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *ginResponseWriter) WriteString(s string) (int, error) {
+	w.detect()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *ginResponseWriter) Flush() {
+	w.detect()
+	w.ResponseWriter.Flush()
+}
+
+func (w *ginResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.Hijack()
+	if err != nil {
+		return conn, rw, err
 	}
+	conn, rw = w.stream.hijacked(conn, rw)
+	return conn, rw, nil
 }
 
+// GinHealthMiddleware is the gin counterpart of HealthMiddleware. It makes sure the
+// application health metrics are exposed by the default registry.
 func GinHealthMiddleware() gin.HandlerFunc {
+	registerDefaultHealthCollector()
 	return func(c *gin.Context) {
-		updateHealthMetrics()
 		c.Next()
 	}
 }
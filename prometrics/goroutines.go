@@ -0,0 +1,266 @@
+package prometrics
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// GoroutinesByOrigin counts the goroutines of the largest groups found by a
+	// GoroutineSampler, labeled by sampler name and origin: the top user code frame of the
+	// goroutines or the function that created them. The remaining goroutines are summed up
+	// as origin "other".
+	//
+	// Metric type: GaugeVec
+	GoroutinesByOrigin = CreateGauge("app_goroutines_by_origin", "Number of goroutines by origin (top user frame or creating function).", []string{"sampler", "origin"})
+	// GoroutineLeakSuspect is 1 for the goroutine origins whose count grew at every one of
+	// the last samples, a typical sign of a goroutine leak, labeled by sampler name and origin.
+	//
+	// Metric type: GaugeVec
+	GoroutineLeakSuspect = CreateGauge("app_goroutines_leak_suspect", "1 when the goroutines of an origin grew monotonically over the last samples.", []string{"sampler", "origin"})
+)
+
+// GoroutineSamplerOption configures a GoroutineSampler.
+type GoroutineSamplerOption func(*GoroutineSampler)
+
+// WithGoroutineTopN sets how many origins are exported, the default is 20. Keeping it
+// small bounds the number of app_goroutines_by_origin series.
+func WithGoroutineTopN(n int) GoroutineSamplerOption {
+	return func(s *GoroutineSampler) {
+		s.topN = n
+	}
+}
+
+// WithGoroutineGroupByCreator groups goroutines by the function that created them
+// ("created by" in a stack dump) instead of their top user code frame.
+func WithGoroutineGroupByCreator() GoroutineSamplerOption {
+	return func(s *GoroutineSampler) {
+		s.byCreator = true
+	}
+}
+
+// WithGoroutineSamplerName sets the sampler label of the series of the sampler. The
+// default is "creator" with WithGoroutineGroupByCreator and "frame" otherwise. Every
+// sampler only replaces its own series, so samplers running side by side need distinct names.
+func WithGoroutineSamplerName(name string) GoroutineSamplerOption {
+	return func(s *GoroutineSampler) {
+		s.name = name
+	}
+}
+
+// WithGoroutineLeakWindow sets over how many samples an origin has to grow monotonically
+// to be flagged as a leak suspect. The default is 5.
+func WithGoroutineLeakWindow(samples int) GoroutineSamplerOption {
+	return func(s *GoroutineSampler) {
+		s.window = samples
+	}
+}
+
+// GoroutineSampler periodically dumps the stacks of all goroutines and groups them by
+// origin, telling where the goroutines counted by app_go_routines come from. It sets
+// GoroutinesByOrigin for the top N origins and GoroutineLeakSuspect for the origins
+// growing monotonically over the leak window.
+//
+// Dumping all stacks briefly stops the world, so the sampler is opt-in and should run
+// every few tens of seconds, not on every scrape.
+type GoroutineSampler struct {
+	name      string
+	topN      int
+	byCreator bool
+	window    int
+
+	mu      sync.Mutex
+	history map[string][]int
+	buf     []byte
+}
+
+// NewGoroutineSampler creates a GoroutineSampler. Its Sample method is a CollectFunc that
+// can be registered with a Scheduler.
+func NewGoroutineSampler(opts ...GoroutineSamplerOption) *GoroutineSampler {
+	s := &GoroutineSampler{topN: 20, window: 5, history: make(map[string][]int)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.name == "" {
+		s.name = "frame"
+		if s.byCreator {
+			s.name = "creator"
+		}
+	}
+	return s
+}
+
+// RegisterGoroutineSampler registers a GoroutineSampler as the "goroutine_sampler_<name>"
+// periodic collector of the DefaultScheduler, see WithGoroutineSamplerName.
+//
+// Example:
+//
+//	prometrics.RegisterGoroutineSampler(30*time.Second, prometrics.WithGoroutineTopN(10))
+//	go prometrics.RunPeriodicCollectors(ctx)
+func RegisterGoroutineSampler(interval time.Duration, opts ...GoroutineSamplerOption) error {
+	s := NewGoroutineSampler(opts...)
+	return RegisterPeriodicCollector("goroutine_sampler_"+s.name, interval, s.Sample)
+}
+
+// Sample dumps the goroutine stacks once and updates the metrics.
+func (s *GoroutineSampler) Sample(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.observe(groupGoroutines(s.dump(), s.byCreator))
+	return nil
+}
+
+// dump returns the stacks of all goroutines, growing the buffer until they fit.
+func (s *GoroutineSampler) dump() []byte {
+	if s.buf == nil {
+		s.buf = make([]byte, 64<<10)
+	}
+	for {
+		n := runtime.Stack(s.buf, true)
+		if n < len(s.buf) {
+			return s.buf[:n]
+		}
+		s.buf = make([]byte, 2*len(s.buf))
+	}
+}
+
+// observe exports the top N origins of counts and updates the leak suspects.
+func (s *GoroutineSampler) observe(counts map[string]int) {
+	for origin := range s.history {
+		if _, ok := counts[origin]; !ok {
+			delete(s.history, origin)
+		}
+	}
+	for origin, n := range counts {
+		h := append(s.history[origin], n)
+		if len(h) > s.window {
+			h = h[len(h)-s.window:]
+		}
+		s.history[origin] = h
+	}
+
+	origins := make([]string, 0, len(counts))
+	for origin := range counts {
+		origins = append(origins, origin)
+	}
+	sort.Slice(origins, func(i, j int) bool {
+		if counts[origins[i]] != counts[origins[j]] {
+			return counts[origins[i]] > counts[origins[j]]
+		}
+		return origins[i] < origins[j]
+	})
+
+	own := prometheus.Labels{"sampler": s.name}
+	GoroutinesByOrigin.DeletePartialMatch(own)
+	GoroutineLeakSuspect.DeletePartialMatch(own)
+	other := 0
+	for i, origin := range origins {
+		// a slow leak is flagged even if it is not among the largest origins yet
+		if s.growing(origin) {
+			GoroutineLeakSuspect.WithLabelValues(s.name, origin).Set(1)
+		}
+		if i >= s.topN {
+			other += counts[origin]
+			continue
+		}
+		GoroutinesByOrigin.WithLabelValues(s.name, origin).Set(float64(counts[origin]))
+	}
+	if other > 0 {
+		GoroutinesByOrigin.WithLabelValues(s.name, "other").Set(float64(other))
+	}
+}
+
+// growing reports whether origin grew at every one of the samples of the leak window.
+func (s *GoroutineSampler) growing(origin string) bool {
+	h := s.history[origin]
+	if len(h) < s.window || s.window < 2 {
+		return false
+	}
+	for i := 1; i < len(h); i++ {
+		if h[i] <= h[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// groupGoroutines counts the goroutines of a runtime.Stack dump by origin.
+func groupGoroutines(dump []byte, byCreator bool) map[string]int {
+	counts := make(map[string]int)
+	for _, block := range bytes.Split(dump, []byte("\n\n")) {
+		if origin := goroutineOrigin(string(block), byCreator); origin != "" {
+			counts[origin]++
+		}
+	}
+	return counts
+}
+
+// goroutineOrigin returns the top user code frame of a goroutine stack, or its creator.
+// Goroutines without user code frames fall back to their first frame outside of the runtime.
+func goroutineOrigin(stack string, byCreator bool) string {
+	lines := strings.Split(stack, "\n")
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "goroutine ") {
+		return ""
+	}
+
+	var frames []string
+	creator := ""
+	for _, line := range lines[1:] {
+		switch {
+		case line == "", strings.HasPrefix(line, "\t"), strings.HasPrefix(line, "..."):
+		case strings.HasPrefix(line, "created by "):
+			creator = strings.TrimPrefix(line, "created by ")
+			if i := strings.Index(creator, " in goroutine "); i >= 0 {
+				creator = creator[:i]
+			}
+		default:
+			frames = append(frames, frameFunc(line))
+		}
+	}
+	if byCreator && creator != "" {
+		return creator
+	}
+
+	for _, f := range frames {
+		if !isStdlibFunc(f) {
+			return f
+		}
+	}
+	for _, f := range frames {
+		if !strings.HasPrefix(f, "runtime.") {
+			return f
+		}
+	}
+	if len(frames) > 0 {
+		return frames[0]
+	}
+	return creator
+}
+
+// frameFunc strips the arguments of a stack frame, eg. "main.work(0x1, 0x2)" becomes "main.work".
+func frameFunc(line string) string {
+	if i := strings.LastIndex(line, "("); i > 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// isStdlibFunc reports whether a fully qualified function name belongs to the standard
+// library, whose import paths have no dot in their first element.
+func isStdlibFunc(name string) bool {
+	first := name
+	if i := strings.Index(first, "/"); i >= 0 {
+		first = first[:i]
+	} else if i := strings.Index(first, "."); i >= 0 {
+		first = first[:i]
+	}
+	return first != "main" && !strings.Contains(first, ".")
+}
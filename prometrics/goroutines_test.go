@@ -0,0 +1,90 @@
+package prometrics
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func parkTestGoroutine(wg *sync.WaitGroup, stop <-chan struct{}) {
+	wg.Done()
+	<-stop
+}
+
+func TestGoroutineSampler(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go parkTestGoroutine(&wg, stop)
+	}
+	wg.Wait()
+
+	if err := NewGoroutineSampler().Sample(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	origin := "github.com/peek8/prometric-go/prometrics.parkTestGoroutine"
+	if got := testutil.ToFloat64(GoroutinesByOrigin.WithLabelValues("frame", origin)); got != 5 {
+		t.Errorf("goroutines{%s} = %v, want 5", origin, got)
+	}
+
+	if err := NewGoroutineSampler(WithGoroutineGroupByCreator()).Sample(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	creator := "github.com/peek8/prometric-go/prometrics.TestGoroutineSampler"
+	if got := testutil.ToFloat64(GoroutinesByOrigin.WithLabelValues("creator", creator)); got != 5 {
+		t.Errorf("goroutines{%s} = %v, want 5", creator, got)
+	}
+	if got := testutil.ToFloat64(GoroutinesByOrigin.WithLabelValues("frame", origin)); got != 5 {
+		t.Errorf("goroutines{%s} = %v after sampling by creator, want the frame series to be kept", origin, got)
+	}
+}
+
+func TestGoroutineSamplerLeakSuspect(t *testing.T) {
+	const name = "test-leak"
+	s := NewGoroutineSampler(WithGoroutineSamplerName(name), WithGoroutineTopN(2), WithGoroutineLeakWindow(3))
+	for i := 1; i <= 3; i++ {
+		s.observe(map[string]int{"test.leaky": 10 * i, "test.stable": 4, "test.small": 1, "test.tiny": 1, "test.slow": i})
+	}
+
+	if got := testutil.ToFloat64(GoroutineLeakSuspect.WithLabelValues(name, "test.leaky")); got != 1 {
+		t.Errorf("leak suspect{test.leaky} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(GoroutineLeakSuspect.WithLabelValues(name, "test.slow")); got != 1 {
+		t.Errorf("leak suspect{test.slow} = %v, want 1 outside of the top N", got)
+	}
+	if got := testutil.ToFloat64(GoroutineLeakSuspect.WithLabelValues(name, "test.stable")); got != 0 {
+		t.Errorf("leak suspect{test.stable} = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(GoroutinesByOrigin.WithLabelValues(name, "other")); got != 5 {
+		t.Errorf("goroutines{other} = %v, want 5 beyond the top N", got)
+	}
+
+	s.observe(map[string]int{"test.leaky": 25, "test.stable": 4})
+	if got := testutil.ToFloat64(GoroutineLeakSuspect.WithLabelValues(name, "test.leaky")); got != 0 {
+		t.Errorf("leak suspect{test.leaky} = %v after a decrease, want 0", got)
+	}
+}
+
+func TestGoroutineOrigin(t *testing.T) {
+	stack := `goroutine 7 [IO wait]:
+internal/poll.runtime_pollWait(0x7f, 0x72)
+	/go/src/runtime/netpoll.go:351 +0x85
+net/http.(*conn).serve(0xc000120000, {0x8, 0xc})
+	/go/src/net/http/server.go:2102 +0x625
+created by net/http.(*Server).Serve in goroutine 1
+	/go/src/net/http/server.go:3454 +0x485`
+
+	if got := goroutineOrigin(stack, false); got != "internal/poll.runtime_pollWait" {
+		t.Errorf("origin = %q, want the first frame outside of the runtime", got)
+	}
+	if got := goroutineOrigin(stack, true); got != "net/http.(*Server).Serve" {
+		t.Errorf("creator = %q", got)
+	}
+	if got := goroutineOrigin("goroutine 9 [select]:\nmain.(*worker).loop(...)\n\t/app/main.go:12", false); got != "main.(*worker).loop" {
+		t.Errorf("origin = %q", got)
+	}
+}
@@ -0,0 +1,352 @@
+package prometrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	// GraphQLOperationsTotal counts GraphQL operations, labeled by path, operation name,
+	// operation type (query, mutation, subscription) and HTTP status code.
+	// Each operation of a batched request is counted separately.
+	//
+	// Metric type: CounterVec
+	GraphQLOperationsTotal = CreateCounter("graphql_operations_total", "Total GraphQL operations processed.", []string{"path", "operation", "type", "code"})
+	// GraphQLOperationDuration measures the duration of GraphQL requests in seconds, labeled
+	// by path, operation name and operation type. Operations of a batched request are all
+	// observed with the duration of the whole request.
+	//
+	// Metric type: HistogramVec
+	GraphQLOperationDuration = CreateHistogram("graphql_operation_duration_seconds", "Duration of GraphQL operations in seconds.", []string{"path", "operation", "type"}, nil)
+)
+
+const (
+	graphQLAnonymous = "anonymous"
+	graphQLOther     = "other"
+	graphQLUnknown   = "unknown"
+)
+
+// GraphQLOption configures GraphQLMiddleware.
+type GraphQLOption func(*graphQLConfig)
+
+type graphQLConfig struct {
+	http    []HttpOption
+	maxBody int64
+	allowed map[string]bool
+	limit   int
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newGraphQLConfig(opts []GraphQLOption) *graphQLConfig {
+	cfg := &graphQLConfig{maxBody: 1 << 20, limit: 100}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithGraphQLHttpOptions sets the options of the HTTP metrics recorded by
+// GraphQLMiddleware, eg. WithSampling. Skipped and unsampled requests are not parsed.
+func WithGraphQLHttpOptions(opts ...HttpOption) GraphQLOption {
+	return func(c *graphQLConfig) {
+		c.http = append(c.http, opts...)
+	}
+}
+
+// WithGraphQLOperations restricts the operation label of GraphQLMiddleware to the given
+// operation names. Any other operation is recorded as "other".
+func WithGraphQLOperations(names ...string) GraphQLOption {
+	return func(c *graphQLConfig) {
+		c.allowed = make(map[string]bool, len(names))
+		for _, n := range names {
+			c.allowed[n] = true
+		}
+	}
+}
+
+// WithGraphQLOperationLimit caps the number of distinct operation names recorded by
+// GraphQLMiddleware. Once n names have been seen, new ones are recorded as "other".
+// The default limit is 100.
+func WithGraphQLOperationLimit(n int) GraphQLOption {
+	return func(c *graphQLConfig) {
+		c.limit = n
+	}
+}
+
+// WithGraphQLMaxBodySize sets how many bytes of the request body GraphQLMiddleware reads
+// to find the operations. Larger bodies are passed on untouched and recorded as "unknown".
+// The default is 1 MiB.
+func WithGraphQLMaxBodySize(n int64) GraphQLOption {
+	return func(c *graphQLConfig) {
+		c.maxBody = n
+	}
+}
+
+// GraphQLMiddleware instruments a GraphQL endpoint. Besides the regular HTTP metrics,
+// recorded exactly like InstrumentHttpHandler does, it peeks at the JSON request body
+// (single or batched) or the query parameters of GET requests, and records
+// graphql_operations_total and graphql_operation_duration_seconds by operation name and type.
+// The body is restored before it reaches next.
+//
+// Operation names come from clients, so the label is bounded by WithGraphQLOperations
+// or WithGraphQLOperationLimit. The options of the HTTP metrics are given with
+// WithGraphQLHttpOptions.
+//
+// Example:
+//
+//	mux.Handle("/graphql", prometrics.GraphQLMiddleware("/graphql", srv,
+//	    prometrics.WithGraphQLOperations("GetPerson", "CreatePerson")))
+func GraphQLMiddleware(path string, next http.Handler, opts ...GraphQLOption) http.Handler {
+	gql := newGraphQLConfig(opts)
+	cfg := newHttpConfig(gql.http)
+	inFlight := HttpRequestsInFlight.WithLabelValues(path)
+
+	observe := func(r *http.Request) func(httpObservation) {
+		ops := gql.operations(r)
+		return func(o httpObservation) {
+			for _, op := range ops {
+				GraphQLOperationsTotal.WithLabelValues(path, op.name, op.typ, o.code).Add(o.weight)
+				GraphQLOperationDuration.WithLabelValues(path, op.name, op.typ).Observe(o.elapsed.Seconds())
+			}
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.serveHTTP(path, inFlight, next, w, r, observe)
+	})
+}
+
+type graphQLOperation struct {
+	name string
+	typ  string
+}
+
+type graphQLRequest struct {
+	Query         string `json:"query"`
+	OperationName string `json:"operationName"`
+}
+
+// operations extracts the operations of r, restoring its body.
+func (g *graphQLConfig) operations(r *http.Request) []graphQLOperation {
+	unknown := []graphQLOperation{{name: graphQLUnknown, typ: graphQLUnknown}}
+
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		return []graphQLOperation{g.operation(graphQLRequest{Query: q.Get("query"), OperationName: q.Get("operationName")})}
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return unknown
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, g.maxBody+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || int64(len(body)) > g.maxBody {
+		return unknown
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []graphQLRequest
+		if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+			return unknown
+		}
+		ops := make([]graphQLOperation, len(batch))
+		for i, req := range batch {
+			ops[i] = g.operation(req)
+		}
+		return ops
+	}
+
+	var req graphQLRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return unknown
+	}
+	return []graphQLOperation{g.operation(req)}
+}
+
+func (g *graphQLConfig) operation(req graphQLRequest) graphQLOperation {
+	defs := parseGraphQLOperations(req.Query)
+
+	op := graphQLOperation{name: req.OperationName, typ: graphQLUnknown}
+	for _, d := range defs {
+		if req.OperationName == "" && len(defs) == 1 {
+			op = d
+			break
+		}
+		if d.name == req.OperationName {
+			op.typ = d.typ
+			break
+		}
+	}
+	op.name = g.label(op.name)
+	return op
+}
+
+// label bounds the cardinality of the operation label.
+func (g *graphQLConfig) label(name string) string {
+	if name == "" {
+		return graphQLAnonymous
+	}
+	if g.allowed != nil {
+		if g.allowed[name] {
+			return name
+		}
+		return graphQLOther
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.seen[name] {
+		return name
+	}
+	if len(g.seen) >= g.limit {
+		return graphQLOther
+	}
+	if g.seen == nil {
+		g.seen = make(map[string]bool)
+	}
+	g.seen[name] = true
+	return name
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// parseGraphQLOperations returns the operation definitions (name and type) of a GraphQL
+// document. It only looks at the top level of the document and skips selection sets,
+// arguments, strings and comments, which is enough to tell operations apart without
+// a full GraphQL parser.
+func parseGraphQLOperations(doc string) []graphQLOperation {
+	var ops []graphQLOperation
+	i := 0
+	for i < len(doc) {
+		c := doc[i]
+		switch {
+		case c == '#':
+			i = skipGraphQLComment(doc, i)
+		case c == '"':
+			i = skipGraphQLString(doc, i)
+		case c == '{':
+			// query shorthand
+			ops = append(ops, graphQLOperation{typ: "query"})
+			i = skipGraphQLBlock(doc, i)
+		case isGraphQLNameStart(c):
+			word, next := readGraphQLName(doc, i)
+			i = next
+			switch word {
+			case "query", "mutation", "subscription":
+				op := graphQLOperation{typ: word}
+				j := skipGraphQLIgnored(doc, i)
+				if j < len(doc) && isGraphQLNameStart(doc[j]) {
+					op.name, i = readGraphQLName(doc, j)
+				}
+				ops = append(ops, op)
+			}
+			i = skipGraphQLDefinition(doc, i)
+		default:
+			i++
+		}
+	}
+	return ops
+}
+
+// skipGraphQLDefinition skips the rest of a definition up to and including its selection set.
+func skipGraphQLDefinition(doc string, i int) int {
+	for i < len(doc) {
+		switch doc[i] {
+		case '#':
+			i = skipGraphQLComment(doc, i)
+		case '"':
+			i = skipGraphQLString(doc, i)
+		case '(', '[':
+			i = skipGraphQLBlock(doc, i)
+		case '{':
+			return skipGraphQLBlock(doc, i)
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+// skipGraphQLBlock skips a balanced (), [] or {} block starting at i.
+func skipGraphQLBlock(doc string, i int) int {
+	depth := 0
+	for i < len(doc) {
+		switch doc[i] {
+		case '#':
+			i = skipGraphQLComment(doc, i)
+			continue
+		case '"':
+			i = skipGraphQLString(doc, i)
+			continue
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+		i++
+	}
+	return i
+}
+
+func skipGraphQLString(doc string, i int) int {
+	if len(doc)-i >= 3 && doc[i:i+3] == `"""` {
+		if end := strings.Index(doc[i+3:], `"""`); end >= 0 {
+			return i + 3 + end + 3
+		}
+		return len(doc)
+	}
+	for i++; i < len(doc); i++ {
+		switch doc[i] {
+		case '\\':
+			i++
+		case '"', '\n':
+			return i + 1
+		}
+	}
+	return i
+}
+
+func skipGraphQLComment(doc string, i int) int {
+	for i < len(doc) && doc[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+func skipGraphQLIgnored(doc string, i int) int {
+	for i < len(doc) {
+		switch doc[i] {
+		case ' ', '\t', '\n', '\r', ',':
+			i++
+		case '#':
+			i = skipGraphQLComment(doc, i)
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func readGraphQLName(doc string, i int) (string, int) {
+	start := i
+	for i < len(doc) && (isGraphQLNameStart(doc[i]) || (doc[i] >= '0' && doc[i] <= '9')) {
+		i++
+	}
+	return doc[start:i], i
+}
+
+func isGraphQLNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
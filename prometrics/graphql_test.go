@@ -0,0 +1,97 @@
+package prometrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseGraphQLOperations(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want []graphQLOperation
+	}{
+		{`{ person(id: 1) { name } }`, []graphQLOperation{{typ: "query"}}},
+		{`query GetPerson($id: ID = 1) { person(id: $id) { name } }`, []graphQLOperation{{name: "GetPerson", typ: "query"}}},
+		{
+			`# a comment with mutation Fake
+			query A { search(query: "mutation B { x }") { id } }
+			fragment F on Person { name }
+			mutation B @tag(v: ["}"]) { create { ...F } }`,
+			[]graphQLOperation{{name: "A", typ: "query"}, {name: "B", typ: "mutation"}},
+		},
+		{`subscription { personAdded { id } }`, []graphQLOperation{{typ: "subscription"}}},
+	}
+	for _, tt := range tests {
+		if got := parseGraphQLOperations(tt.doc); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseGraphQLOperations(%q) = %v, want %v", tt.doc, got, tt.want)
+		}
+	}
+}
+
+func TestGraphQLMiddleware(t *testing.T) {
+	path := "/" + uniqueTestName("test-graphql")
+	body := `[
+		{"query": "query GetPerson { person { name } }"},
+		{"query": "query A { a } mutation CreatePerson { create { id } }", "operationName": "CreatePerson"},
+		{"query": "query Secret { secret }"}
+	]`
+
+	var received string
+	handler := GraphQLMiddleware(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = string(b)
+	}), WithGraphQLOperations("GetPerson", "CreatePerson"))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+
+	if received != body {
+		t.Errorf("handler received body %q, want %q", received, body)
+	}
+	for _, op := range [][2]string{{"GetPerson", "query"}, {"CreatePerson", "mutation"}, {"other", "query"}} {
+		if got := testutil.ToFloat64(GraphQLOperationsTotal.WithLabelValues(path, op[0], op[1], "200")); got != 1 {
+			t.Errorf("operations{%s,%s} = %v, want 1", op[0], op[1], got)
+		}
+	}
+	if got := testutil.ToFloat64(HttpRequestsTotal.WithLabelValues(path, "post", "200")); got != 1 {
+		t.Errorf("http requests = %v, want 1", got)
+	}
+}
+
+func TestGraphQLMiddlewareSkipped(t *testing.T) {
+	path := "/" + uniqueTestName("test-graphql")
+	body := io.NopCloser(strings.NewReader(`{"query": "query GetPerson { person { name } }"}`))
+
+	var untouched bool
+	handler := GraphQLMiddleware(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		untouched = r.Body == body
+	}), WithGraphQLHttpOptions(WithSkipPaths(path)))
+
+	r := httptest.NewRequest(http.MethodPost, path, nil)
+	r.Body = body
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !untouched {
+		t.Error("the body of a skipped request was read")
+	}
+	if got := testutil.ToFloat64(GraphQLOperationsTotal.WithLabelValues(path, "GetPerson", "query", "200")); got != 0 {
+		t.Errorf("operations{GetPerson} = %v, want 0 for a skipped request", got)
+	}
+}
+
+func TestGraphQLOperationLimit(t *testing.T) {
+	g := &graphQLConfig{limit: 2}
+	for _, name := range []string{"A", "B", "A"} {
+		if got := g.label(name); got != name {
+			t.Errorf("label(%q) = %q, want %q", name, got, name)
+		}
+	}
+	if got := g.label("C"); got != graphQLOther {
+		t.Errorf("label(C) = %q, want %q", got, graphQLOther)
+	}
+}
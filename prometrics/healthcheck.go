@@ -0,0 +1,305 @@
+package prometrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// HealthCheckStatus reports the result of the last run of each health check,
+	// 1 when it passed and 0 when it failed, labeled by check name.
+	//
+	// Metric type: GaugeVec
+	HealthCheckStatus = CreateGauge("app_health_check_status", "Result of the last health check run, 1 for passing and 0 for failing.", []string{"check"})
+	// HealthCheckDuration measures the duration of health check runs in seconds, labeled by check name.
+	//
+	// Metric type: HistogramVec
+	HealthCheckDuration = CreateHistogram("app_health_check_duration_seconds", "Duration of health check runs in seconds.", []string{"check"}, nil)
+)
+
+// Probe is a kind of Kubernetes probe a health check takes part in.
+type Probe string
+
+const (
+	ProbeLiveness  Probe = "livez"
+	ProbeReadiness Probe = "readyz"
+	ProbeStartup   Probe = "startupz"
+)
+
+// CheckFunc checks a dependency or an internal condition, returning an error when unhealthy.
+type CheckFunc func(ctx context.Context) error
+
+// CheckOption configures a health check.
+type CheckOption func(*healthCheck)
+
+// WithCheckTimeout sets how long a check may run before it fails. The default is 5 seconds.
+func WithCheckTimeout(timeout time.Duration) CheckOption {
+	return func(c *healthCheck) {
+		c.timeout = timeout
+	}
+}
+
+// WithCheckNonCritical marks a check as non-critical: its failure is reported in the
+// probe response and metrics but does not fail the probe.
+func WithCheckNonCritical() CheckOption {
+	return func(c *healthCheck) {
+		c.critical = false
+	}
+}
+
+// WithCheckCacheTTL reuses the result of a check for ttl, so frequent probes do not
+// hammer the checked dependency.
+func WithCheckCacheTTL(ttl time.Duration) CheckOption {
+	return func(c *healthCheck) {
+		c.cacheTTL = ttl
+	}
+}
+
+// WithCheckInterval runs the check in the background every interval, using the Scheduler
+// of the HealthChecker. Probes then answer with the last result, as long as it is not
+// older than twice the interval.
+func WithCheckInterval(interval time.Duration) CheckOption {
+	return func(c *healthCheck) {
+		c.interval = interval
+	}
+}
+
+// WithCheckProbes sets the probes a check takes part in. The default is ProbeReadiness only.
+func WithCheckProbes(probes ...Probe) CheckOption {
+	return func(c *healthCheck) {
+		c.probes = probes
+	}
+}
+
+type healthCheck struct {
+	name     string
+	fn       CheckFunc
+	timeout  time.Duration
+	critical bool
+	cacheTTL time.Duration
+	interval time.Duration
+	probes   []Probe
+
+	mu       sync.Mutex
+	last     checkResult
+	hasValue bool
+}
+
+type checkResult struct {
+	err      error
+	at       time.Time
+	duration time.Duration
+}
+
+// HealthChecker holds named health checks and serves them as Kubernetes probe handlers
+// (/livez, /readyz, /startupz) with a JSON body describing every check.
+type HealthChecker struct {
+	scheduler *Scheduler
+
+	mu     sync.RWMutex
+	checks map[string]*healthCheck
+}
+
+// DefaultHealthChecker is the HealthChecker used by RegisterHealthCheck and the probe handlers
+// of the package. Its background checks run on the DefaultScheduler.
+var DefaultHealthChecker = NewHealthChecker(DefaultScheduler)
+
+// NewHealthChecker creates a HealthChecker. Checks registered with WithCheckInterval run
+// on scheduler, which must be running (see Scheduler.Run).
+func NewHealthChecker(scheduler *Scheduler) *HealthChecker {
+	return &HealthChecker{scheduler: scheduler, checks: make(map[string]*healthCheck)}
+}
+
+// Register adds a named health check.
+//
+// Example:
+//
+//	checker.Register("database", db.PingContext,
+//	    prometrics.WithCheckProbes(prometrics.ProbeReadiness, prometrics.ProbeStartup),
+//	    prometrics.WithCheckTimeout(time.Second))
+func (h *HealthChecker) Register(name string, fn CheckFunc, opts ...CheckOption) error {
+	c := &healthCheck{
+		name:     name,
+		fn:       fn,
+		timeout:  5 * time.Second,
+		critical: true,
+		probes:   []Probe{ProbeReadiness},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	h.mu.Lock()
+	if _, ok := h.checks[name]; ok {
+		h.mu.Unlock()
+		return fmt.Errorf("prometrics: health check %q already registered", name)
+	}
+	h.checks[name] = c
+	h.mu.Unlock()
+
+	if c.interval > 0 {
+		err := h.scheduler.Register("health_check_"+name, c.interval, func(ctx context.Context) error {
+			c.run(ctx)
+			return nil
+		}, WithTimeout(c.timeout))
+		if err != nil {
+			// a check that never runs would report a stale state
+			h.mu.Lock()
+			delete(h.checks, name)
+			h.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// result returns the cached result of the check if still fresh, or runs it.
+func (c *healthCheck) result(ctx context.Context) checkResult {
+	maxAge := c.cacheTTL
+	if c.interval > 0 && 2*c.interval > maxAge {
+		maxAge = 2 * c.interval
+	}
+	if maxAge > 0 {
+		c.mu.Lock()
+		last, ok := c.last, c.hasValue
+		c.mu.Unlock()
+		if ok && time.Since(last.at) < maxAge {
+			return last
+		}
+	}
+	return c.run(ctx)
+}
+
+// run runs the check, recording its status and duration.
+func (c *healthCheck) run(ctx context.Context) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.call(ctx)
+	duration := time.Since(start)
+	switch {
+	case err == nil && duration >= c.timeout:
+		// the check ignored its context
+		err = fmt.Errorf("timed out after %s", c.timeout)
+	case errors.Is(err, context.DeadlineExceeded):
+		err = fmt.Errorf("timed out after %s: %w", c.timeout, err)
+	}
+	res := checkResult{err: err, at: start, duration: duration}
+
+	HealthCheckDuration.WithLabelValues(c.name).Observe(res.duration.Seconds())
+	status := 1.0
+	if err != nil {
+		status = 0
+	}
+	HealthCheckStatus.WithLabelValues(c.name).Set(status)
+
+	c.mu.Lock()
+	c.last, c.hasValue = res, true
+	c.mu.Unlock()
+	return res
+}
+
+func (c *healthCheck) call(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return c.fn(ctx)
+}
+
+// CheckStatus is the JSON representation of a check in a probe response.
+type CheckStatus struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Critical bool   `json:"critical"`
+	Duration string `json:"duration"`
+}
+
+// ProbeStatus is the JSON body of a probe response.
+type ProbeStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckStatus `json:"checks"`
+}
+
+// Evaluate runs (or reads from cache) every check of probe concurrently. The probe
+// passes when no critical check fails.
+func (h *HealthChecker) Evaluate(ctx context.Context, probe Probe) (ProbeStatus, bool) {
+	h.mu.RLock()
+	var checks []*healthCheck
+	for _, c := range h.checks {
+		if slices.Contains(c.probes, probe) {
+			checks = append(checks, c)
+		}
+	}
+	h.mu.RUnlock()
+	sort.Slice(checks, func(i, j int) bool { return checks[i].name < checks[j].name })
+
+	results := make([]checkResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.result(ctx)
+		}()
+	}
+	wg.Wait()
+
+	status := ProbeStatus{Status: "ok", Checks: make(map[string]CheckStatus, len(checks))}
+	healthy := true
+	for i, c := range checks {
+		cs := CheckStatus{Status: "ok", Critical: c.critical, Duration: results[i].duration.String()}
+		if err := results[i].err; err != nil {
+			cs.Status, cs.Error = "fail", err.Error()
+			if c.critical {
+				healthy = false
+			}
+		}
+		status.Checks[c.name] = cs
+	}
+	if !healthy {
+		status.Status = "fail"
+	}
+	return status, healthy
+}
+
+// Handler returns an http.Handler for probe. It answers 200 when the probe passes and
+// 503 otherwise, with a ProbeStatus JSON body.
+func (h *HealthChecker) Handler(probe Probe) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, healthy := h.Evaluate(r.Context(), probe)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+// RegisterHealthCheck registers a check with the DefaultHealthChecker.
+func RegisterHealthCheck(name string, fn CheckFunc, opts ...CheckOption) error {
+	return DefaultHealthChecker.Register(name, fn, opts...)
+}
+
+// LivezHandler serves the liveness probe of the DefaultHealthChecker.
+//
+//	mux.Handle("/livez", prometrics.LivezHandler())
+//	mux.Handle("/readyz", prometrics.ReadyzHandler())
+//	mux.Handle("/startupz", prometrics.StartupzHandler())
+func LivezHandler() http.Handler { return DefaultHealthChecker.Handler(ProbeLiveness) }
+
+// ReadyzHandler serves the readiness probe of the DefaultHealthChecker.
+func ReadyzHandler() http.Handler { return DefaultHealthChecker.Handler(ProbeReadiness) }
+
+// StartupzHandler serves the startup probe of the DefaultHealthChecker.
+func StartupzHandler() http.Handler { return DefaultHealthChecker.Handler(ProbeStartup) }
@@ -0,0 +1,109 @@
+package prometrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHealthCheckerProbes(t *testing.T) {
+	h := NewHealthChecker(NewScheduler())
+
+	var dbCalls atomic.Int32
+	h.Register("test_db", func(ctx context.Context) error {
+		dbCalls.Add(1)
+		return nil
+	}, WithCheckProbes(ProbeReadiness, ProbeStartup), WithCheckCacheTTL(time.Minute))
+	h.Register("test_cache", func(ctx context.Context) error {
+		return errors.New("cache unreachable")
+	}, WithCheckNonCritical())
+	h.Register("test_slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}, WithCheckProbes(ProbeLiveness), WithCheckTimeout(5*time.Millisecond))
+
+	serve := func(probe Probe) (int, ProbeStatus) {
+		w := httptest.NewRecorder()
+		h.Handler(probe).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+string(probe), nil))
+		var status ProbeStatus
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, status
+	}
+
+	code, status := serve(ProbeReadiness)
+	if code != http.StatusOK || status.Status != "ok" {
+		t.Errorf("readyz = %d %q, want 200 ok with a failing non-critical check", code, status.Status)
+	}
+	if status.Checks["test_cache"].Status != "fail" || status.Checks["test_cache"].Error == "" {
+		t.Errorf("readyz test_cache = %+v, want a failure", status.Checks["test_cache"])
+	}
+
+	if code, status = serve(ProbeLiveness); code != http.StatusServiceUnavailable || status.Status != "fail" {
+		t.Errorf("livez = %d %q, want 503 fail after a timeout", code, status.Status)
+	}
+
+	serve(ProbeStartup)
+	if got := dbCalls.Load(); got != 1 {
+		t.Errorf("test_db ran %d times, want 1 thanks to the cache", got)
+	}
+
+	if got := testutil.ToFloat64(HealthCheckStatus.WithLabelValues("test_cache")); got != 0 {
+		t.Errorf("status{test_cache} = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(HealthCheckStatus.WithLabelValues("test_db")); got != 1 {
+		t.Errorf("status{test_db} = %v, want 1", got)
+	}
+}
+
+func TestHealthCheckerBackground(t *testing.T) {
+	s := NewScheduler()
+	h := NewHealthChecker(s)
+
+	var calls atomic.Int32
+	if err := h.Register("test_background", func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}, WithCheckInterval(5*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	s.Run(ctx)
+
+	before := calls.Load()
+	if before < 2 {
+		t.Fatalf("background check ran %d times, want at least 2", before)
+	}
+	if _, healthy := h.Evaluate(context.Background(), ProbeReadiness); !healthy {
+		t.Error("readiness failed")
+	}
+	if calls.Load() != before {
+		t.Error("probe ran the check again although a fresh background result was available")
+	}
+}
+
+func TestHealthCheckerRegisterRollsBack(t *testing.T) {
+	s := NewScheduler()
+	if err := s.Register("health_check_test_taken", time.Second, func(context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHealthChecker(s)
+
+	err := h.Register("test_taken", func(ctx context.Context) error { return errors.New("down") }, WithCheckInterval(time.Second))
+	if err == nil {
+		t.Fatal("Register succeeded although the scheduler rejected the check")
+	}
+	if status, healthy := h.Evaluate(context.Background(), ProbeReadiness); !healthy || len(status.Checks) != 0 {
+		t.Errorf("Evaluate() = %+v, %v, want the rejected check not to be registered", status, healthy)
+	}
+}
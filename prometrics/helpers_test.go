@@ -0,0 +1,14 @@
+package prometrics
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var testNameSeq atomic.Int64
+
+// uniqueTestName returns prefix with a unique suffix, for names that can only be
+// registered once per process, so tests can run with -count.
+func uniqueTestName(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, testNameSeq.Add(1))
+}
@@ -0,0 +1,201 @@
+package prometrics
+
+import (
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/host"
+	"github.com/shirou/gopsutil/load"
+	"github.com/shirou/gopsutil/mem"
+	psnet "github.com/shirou/gopsutil/net"
+)
+
+// HostOption configures the HostCollector.
+type HostOption func(*HostCollector)
+
+// WithHostMountPoints sets the mount points whose disk usage and inodes are exported.
+// The default is "/" only. A mount point listed more than once, eg. when the list comes
+// from disk.Partitions with bind mounts or overlays sharing a mount point, is exported once.
+func WithHostMountPoints(paths ...string) HostOption {
+	return func(c *HostCollector) {
+		c.mountPoints = paths
+	}
+}
+
+// WithHostInterfaces restricts the network metrics to the given interfaces.
+// By default every interface but the loopback is exported.
+func WithHostInterfaces(names ...string) HostOption {
+	return func(c *HostCollector) {
+		c.interfaces = names
+	}
+}
+
+// WithHostCacheTTL sets how long the host readings are reused between scrapes.
+// The default is 15 seconds, a TTL of 0 reads the host on every scrape.
+func WithHostCacheTTL(ttl time.Duration) HostOption {
+	return func(c *HostCollector) {
+		c.ttl = ttl
+	}
+}
+
+var (
+	hostLoad1Desc            = prometheus.NewDesc("app_host_load1", "1 minute load average of the host.", nil, nil)
+	hostLoad5Desc            = prometheus.NewDesc("app_host_load5", "5 minutes load average of the host.", nil, nil)
+	hostLoad15Desc           = prometheus.NewDesc("app_host_load15", "15 minutes load average of the host.", nil, nil)
+	hostMemTotalDesc         = prometheus.NewDesc("app_host_memory_total_bytes", "Total memory of the host in bytes.", nil, nil)
+	hostMemAvailableDesc     = prometheus.NewDesc("app_host_memory_available_bytes", "Memory of the host available for new processes in bytes.", nil, nil)
+	hostMemUsedDesc          = prometheus.NewDesc("app_host_memory_used_bytes", "Used memory of the host in bytes.", nil, nil)
+	hostSwapTotalDesc        = prometheus.NewDesc("app_host_swap_total_bytes", "Total swap of the host in bytes.", nil, nil)
+	hostSwapUsedDesc         = prometheus.NewDesc("app_host_swap_used_bytes", "Used swap of the host in bytes.", nil, nil)
+	hostUptimeDesc           = prometheus.NewDesc("app_host_uptime_seconds", "Uptime of the host in seconds.", nil, nil)
+	hostFsSizeDesc           = prometheus.NewDesc("app_host_filesystem_size_bytes", "Size of the filesystem in bytes.", []string{"mountpoint", "fstype"}, nil)
+	hostFsFreeDesc           = prometheus.NewDesc("app_host_filesystem_free_bytes", "Free space of the filesystem in bytes.", []string{"mountpoint", "fstype"}, nil)
+	hostFsUsedDesc           = prometheus.NewDesc("app_host_filesystem_used_bytes", "Used space of the filesystem in bytes.", []string{"mountpoint", "fstype"}, nil)
+	hostFsInodesDesc         = prometheus.NewDesc("app_host_filesystem_inodes", "Total inodes of the filesystem.", []string{"mountpoint", "fstype"}, nil)
+	hostFsInodesFreeDesc     = prometheus.NewDesc("app_host_filesystem_inodes_free", "Free inodes of the filesystem.", []string{"mountpoint", "fstype"}, nil)
+	hostNetReceiveBytesDesc  = prometheus.NewDesc("app_host_network_receive_bytes_total", "Total bytes received by the network interface.", []string{"interface"}, nil)
+	hostNetTransmitBytesDesc = prometheus.NewDesc("app_host_network_transmit_bytes_total", "Total bytes transmitted by the network interface.", []string{"interface"}, nil)
+	hostNetReceiveErrsDesc   = prometheus.NewDesc("app_host_network_receive_errors_total", "Total receive errors of the network interface.", []string{"interface"}, nil)
+	hostNetTransmitErrsDesc  = prometheus.NewDesc("app_host_network_transmit_errors_total", "Total transmit errors of the network interface.", []string{"interface"}, nil)
+)
+
+// HostCollector is a prometheus.Collector exporting host level metrics read with gopsutil:
+// load averages, memory and swap, uptime, disk usage and inodes of configured mount points
+// and network interface counters. It is meant for deployments without node_exporter.
+//
+// Readings are cached for a TTL (see WithHostCacheTTL), so frequent scrapes stay cheap.
+// A reading that fails, eg. a mount point that does not exist, is left out of the scrape.
+type HostCollector struct {
+	mountPoints []string
+	interfaces  []string
+	ttl         time.Duration
+	read        func() []prometheus.Metric
+
+	mu     sync.Mutex
+	cached []prometheus.Metric
+	readAt time.Time
+}
+
+// NewHostCollector creates a HostCollector.
+func NewHostCollector(opts ...HostOption) *HostCollector {
+	c := &HostCollector{mountPoints: []string{"/"}, ttl: 15 * time.Second}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.read = c.readHost
+	return c
+}
+
+// RegisterHostCollector creates a HostCollector and registers it with reg, or with
+// prometheus.DefaultRegisterer if reg is nil.
+//
+// Example:
+//
+//	prometrics.RegisterHostCollector(nil,
+//	    prometrics.WithHostMountPoints("/", "/var/lib/data"),
+//	    prometrics.WithHostCacheTTL(30*time.Second))
+func RegisterHostCollector(reg prometheus.Registerer, opts ...HostOption) error {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	return reg.Register(NewHostCollector(opts...))
+}
+
+// Describe implements prometheus.Collector.
+func (c *HostCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		hostLoad1Desc, hostLoad5Desc, hostLoad15Desc,
+		hostMemTotalDesc, hostMemAvailableDesc, hostMemUsedDesc, hostSwapTotalDesc, hostSwapUsedDesc,
+		hostUptimeDesc,
+		hostFsSizeDesc, hostFsFreeDesc, hostFsUsedDesc, hostFsInodesDesc, hostFsInodesFreeDesc,
+		hostNetReceiveBytesDesc, hostNetTransmitBytesDesc, hostNetReceiveErrsDesc, hostNetTransmitErrsDesc,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *HostCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	if c.cached == nil || time.Since(c.readAt) >= c.ttl {
+		c.cached, c.readAt = c.read(), time.Now()
+	}
+	metrics := c.cached
+	c.mu.Unlock()
+
+	// const metrics are immutable, the cached ones can be sent again
+	for _, m := range metrics {
+		ch <- m
+	}
+}
+
+// readHost reads every host metric once.
+func (c *HostCollector) readHost() []prometheus.Metric {
+	metrics := []prometheus.Metric{}
+	gauge := func(desc *prometheus.Desc, v float64, labels ...string) {
+		metrics = append(metrics, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, labels...))
+	}
+	counter := func(desc *prometheus.Desc, v float64, labels ...string) {
+		metrics = append(metrics, prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, labels...))
+	}
+
+	if avg, err := load.Avg(); err == nil {
+		gauge(hostLoad1Desc, avg.Load1)
+		gauge(hostLoad5Desc, avg.Load5)
+		gauge(hostLoad15Desc, avg.Load15)
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		gauge(hostMemTotalDesc, float64(vm.Total))
+		gauge(hostMemAvailableDesc, float64(vm.Available))
+		gauge(hostMemUsedDesc, float64(vm.Used))
+	}
+	if swap, err := mem.SwapMemory(); err == nil {
+		gauge(hostSwapTotalDesc, float64(swap.Total))
+		gauge(hostSwapUsedDesc, float64(swap.Used))
+	}
+	if uptime, err := host.Uptime(); err == nil {
+		gauge(hostUptimeDesc, float64(uptime))
+	}
+
+	seen := make(map[string]bool, len(c.mountPoints))
+	for _, path := range c.mountPoints {
+		path = filepath.Clean(path)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		usage, err := disk.Usage(path)
+		if err != nil {
+			continue
+		}
+		gauge(hostFsSizeDesc, float64(usage.Total), path, usage.Fstype)
+		gauge(hostFsFreeDesc, float64(usage.Free), path, usage.Fstype)
+		gauge(hostFsUsedDesc, float64(usage.Used), path, usage.Fstype)
+		gauge(hostFsInodesDesc, float64(usage.InodesTotal), path, usage.Fstype)
+		gauge(hostFsInodesFreeDesc, float64(usage.InodesFree), path, usage.Fstype)
+	}
+
+	if stats, err := psnet.IOCounters(true); err == nil {
+		for _, s := range stats {
+			if !c.interfaceExported(s.Name) {
+				continue
+			}
+			counter(hostNetReceiveBytesDesc, float64(s.BytesRecv), s.Name)
+			counter(hostNetTransmitBytesDesc, float64(s.BytesSent), s.Name)
+			counter(hostNetReceiveErrsDesc, float64(s.Errin), s.Name)
+			counter(hostNetTransmitErrsDesc, float64(s.Errout), s.Name)
+		}
+	}
+	return metrics
+}
+
+func (c *HostCollector) interfaceExported(name string) bool {
+	if len(c.interfaces) == 0 {
+		return name != "lo" && name != "lo0"
+	}
+	return slices.Contains(c.interfaces, name)
+}
@@ -0,0 +1,58 @@
+package prometrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHostCollector(t *testing.T) {
+	c := NewHostCollector(WithHostMountPoints("/", "/does-not-exist", "/", "//"))
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]int)
+	for _, f := range families {
+		found[f.GetName()] = len(f.GetMetric())
+	}
+	for _, name := range []string{"app_host_load1", "app_host_memory_total_bytes", "app_host_uptime_seconds"} {
+		if found[name] != 1 {
+			t.Errorf("%s has %d series, want 1", name, found[name])
+		}
+	}
+	if found["app_host_filesystem_size_bytes"] != 1 {
+		t.Errorf("app_host_filesystem_size_bytes has %d series, want 1 for the existing mount point", found["app_host_filesystem_size_bytes"])
+	}
+}
+
+func TestHostCollectorCache(t *testing.T) {
+	c := NewHostCollector(WithHostCacheTTL(time.Hour))
+	reads := 0
+	c.read = func() []prometheus.Metric {
+		reads++
+		return []prometheus.Metric{prometheus.MustNewConstMetric(hostLoad1Desc, prometheus.GaugeValue, float64(reads))}
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := testutil.CollectAndCount(c); got != 1 {
+			t.Fatalf("collected %d metrics, want 1", got)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("host read %d times within the TTL, want 1", reads)
+	}
+
+	c.ttl = 0
+	testutil.CollectAndCount(c)
+	if reads != 2 {
+		t.Errorf("host read %d times without TTL, want 2", reads)
+	}
+}
@@ -10,9 +10,9 @@ package prometrics
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // type HttpMetricHandler struct {
@@ -28,32 +28,66 @@ import (
 // InstrumentHttpHandler instruments an http.Handler with Prometheus metrics.
 //
 // It records total requests, request duration, in-flight requests, request size and response size.
+// Long-lived streams such as WebSocket upgrades or server-sent events are detected and recorded
+// in the http_stream_* metrics instead of the request duration, see Stream.
 // The "handler" label is set from the given handlerName parameter.
 // The returned handler can be used directly in an http.ServeMux.
+// Optional behaviour, eg. WithQueueTime, can be enabled with HttpOption values.
 //
 // Example:
 //
 //	http.Handle("/api",
 //	    prometrics.InstrumentHttpHandler("api", myHandler),
 //	)
-func InstrumentHttpHandler(handlerName string, next http.Handler) http.Handler {
-	h := promhttp.InstrumentHandlerInFlight(HttpRequestsInFlight.WithLabelValues(handlerName),
-		promhttp.InstrumentHandlerDuration(
-			HttpRequestDuration.MustCurryWith(handlerLabel(handlerName)),
-			promhttp.InstrumentHandlerCounter(
-				HttpRequestsTotal.MustCurryWith(handlerLabel(handlerName)),
-				promhttp.InstrumentHandlerResponseSize(
-					HttpResponseSize.MustCurryWith(handlerLabel(handlerName)),
-					promhttp.InstrumentHandlerRequestSize(
-						HttpRequestSize.MustCurryWith(handlerLabel(handlerName)),
-						next,
-					),
-				),
-			),
-		),
-	)
-
-	return h
+func InstrumentHttpHandler(handlerName string, next http.Handler, opts ...HttpOption) http.Handler {
+	cfg := newHttpConfig(opts)
+	inFlight := HttpRequestsInFlight.WithLabelValues(handlerName)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.serveHTTP(handlerName, inFlight, next, w, r, nil)
+	})
+}
+
+// serveHTTP serves r with next and records the HTTP metrics for it. If observe is not nil
+// it is called before next with the requests that are recorded, ie not skipped nor left
+// out by sampling, and the function it returns is called with the recorded observation,
+// so other views (eg. GraphQL operations) can be derived from exactly the same values.
+func (c *httpConfig) serveHTTP(path string, inFlight prometheus.Gauge, next http.Handler, w http.ResponseWriter, r *http.Request, observe func(r *http.Request) func(httpObservation)) {
+	weight, ok := c.sample(path, r)
+	if !ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+	var done func(httpObservation)
+	if observe != nil {
+		done = observe(r)
+	}
+
+	start := time.Now()
+	inFlight.Add(weight)
+	defer inFlight.Sub(weight)
+
+	c.observeQueueTime(path, r, start)
+
+	stream := newRequestStream(path, r, start)
+	rw := newResponseWriter(w, stream)
+	next.ServeHTTP(rw.delegator(), stream.withContext(r))
+
+	o := httpObservation{
+		request:  r,
+		path:     path,
+		method:   r.Method,
+		code:     rw.code(),
+		elapsed:  time.Since(start),
+		reqSize:  approximateRequestSize(r),
+		respSize: rw.written,
+		stream:   stream,
+		weight:   weight,
+	}
+	c.recordRequest(&o)
+	if done != nil {
+		done(o)
+	}
 }
 
 // func init() {
@@ -90,11 +124,17 @@ func InstrumentHttpHandler(handlerName string, next http.Handler) http.Handler {
 // 	// }, next)
 // }
 
-func handlerLabel(name string) prometheus.Labels {
-	return prometheus.Labels{"path": name}
-}
-
 // HttpMiddleware is a generic version to wrap muxes or routers easily
 func HttpMiddleware(next http.Handler) http.Handler {
 	return InstrumentHttpHandler("default", next)
 }
+
+// NewHttpMiddleware returns a HttpMiddleware configured with the given options.
+// It can be used wherever a func(http.Handler) http.Handler is expected, eg. gorilla mux:
+//
+//	r.Use(prometrics.NewHttpMiddleware(prometrics.WithQueueTime()))
+func NewHttpMiddleware(opts ...HttpOption) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return InstrumentHttpHandler("default", next, opts...)
+	}
+}
@@ -0,0 +1,92 @@
+package prometrics
+
+import (
+	"net/http"
+	"time"
+)
+
+// HttpOption configures the HTTP middlewares, ie InstrumentHttpHandler,
+// NewHttpMiddleware and GinMiddleware.
+type HttpOption func(*httpConfig)
+
+type httpConfig struct {
+	queueTime       bool
+	queueHeaders    []string
+	queueSkew       time.Duration
+	queueMaxLatency time.Duration
+	streamDurations bool
+	skip            []pathRule
+	sampling        []sampleRule
+	transforms      []LabelTransform
+}
+
+func newHttpConfig(opts []HttpOption) *httpConfig {
+	cfg := &httpConfig{
+		queueHeaders:    []string{"X-Request-Start", "X-Queue-Start"},
+		queueSkew:       time.Second,
+		queueMaxLatency: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithQueueTime enables the http_request_queue_duration_seconds{path} metric.
+// The time a request spent queued in the load balancer or ingress is taken
+// from the X-Request-Start or X-Queue-Start header, whichever is set first.
+//
+// Custom header names can be given to replace the default ones.
+//
+// Example:
+//
+//	mux.Handle("/person", prometrics.InstrumentHttpHandler("/person", h, prometrics.WithQueueTime()))
+func WithQueueTime(headers ...string) HttpOption {
+	return func(c *httpConfig) {
+		c.queueTime = true
+		if len(headers) > 0 {
+			c.queueHeaders = headers
+		}
+	}
+}
+
+// WithQueueTimeLimits sets the guards applied to queue time observations.
+// A request start that lies up to skew in the future (because the proxy clock
+// is ahead of ours) is observed as zero queue time, anything further ahead or
+// older than max is considered bogus and dropped.
+//
+// Defaults are 1 second for skew and 1 minute for max.
+func WithQueueTimeLimits(skew, max time.Duration) HttpOption {
+	return func(c *httpConfig) {
+		c.queueSkew = skew
+		c.queueMaxLatency = max
+	}
+}
+
+// WithStreamDurations records long-lived streams (WebSocket, SSE, hijacked connections...)
+// in http_request_duration_seconds as well. By default they are left out, as a single
+// hour-long session would distort the histogram, and only show up in
+// http_stream_duration_seconds.
+func WithStreamDurations() HttpOption {
+	return func(c *httpConfig) {
+		c.streamDurations = true
+	}
+}
+
+// observeQueueTime records the queue duration of r, if enabled and the
+// request carries a usable start header.
+func (c *httpConfig) observeQueueTime(path string, r *http.Request, now time.Time) {
+	if !c.queueTime {
+		return
+	}
+	for _, h := range c.queueHeaders {
+		v := r.Header.Get(h)
+		if v == "" {
+			continue
+		}
+		if d, ok := queueDuration(v, now, c.queueSkew, c.queueMaxLatency); ok {
+			HttpRequestQueueDuration.WithLabelValues(path).Observe(d.Seconds())
+		}
+		return
+	}
+}
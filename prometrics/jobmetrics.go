@@ -0,0 +1,161 @@
+package prometrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// JobRunsTotal counts the runs of scheduled jobs, labeled by job name.
+	//
+	// Metric type: CounterVec
+	JobRunsTotal = CreateCounter("job_runs_total", "Total runs of scheduled jobs", []string{"job"})
+	// JobFailuresTotal counts the failed runs of scheduled jobs, labeled by job name and
+	// reason (error, panic).
+	//
+	// Metric type: CounterVec
+	JobFailuresTotal = CreateCounter("job_failures_total", "Total failed runs of scheduled jobs", []string{"job", "reason"})
+	// JobLastSuccess reports the Unix time of the last successful run, labeled by job name.
+	//
+	// Metric type: GaugeVec
+	JobLastSuccess = CreateGauge("job_last_success_timestamp_seconds", "Unix time of the last successful job run", []string{"job"})
+	// JobLastRunDuration reports the duration of the last run in seconds, labeled by job name.
+	//
+	// Metric type: GaugeVec
+	JobLastRunDuration = CreateGauge("job_last_run_duration_seconds", "Duration of the last job run in seconds", []string{"job"})
+	// JobRunning reports the number of runs in progress, labeled by job name.
+	//
+	// Metric type: GaugeVec
+	JobRunning = CreateGauge("job_running", "Number of job runs in progress", []string{"job"})
+)
+
+// TrackJob records a run of a scheduled job. It should be deferred at the start of the
+// run with a pointer to the error of the run, like TrackCRUDErr:
+//
+//	func cleanup(ctx context.Context) (err error) {
+//	    defer prometrics.TrackJob("cleanup")(&err)
+//	    ...
+//	}
+//
+// It counts the run, sets job_running while it lasts and job_last_run_duration_seconds
+// once it ends. Successful runs set job_last_success_timestamp_seconds, failed runs are
+// counted in job_failures_total. A panic is counted with reason "panic" and then
+// propagated. A nil pointer counts as a success.
+func TrackJob(name string) func(err *error) {
+	start := time.Now()
+	JobRunning.WithLabelValues(name).Inc()
+	return func(errp *error) {
+		r := recover()
+
+		end := time.Now()
+		JobRunning.WithLabelValues(name).Dec()
+		JobRunsTotal.WithLabelValues(name).Inc()
+		JobLastRunDuration.WithLabelValues(name).Set(end.Sub(start).Seconds())
+		switch {
+		case r != nil:
+			JobFailuresTotal.WithLabelValues(name, "panic").Inc()
+			panic(r)
+		case errp != nil && *errp != nil:
+			JobFailuresTotal.WithLabelValues(name, "error").Inc()
+		default:
+			JobLastSuccess.WithLabelValues(name).Set(float64(end.UnixNano()) / 1e9)
+			jobSchedule.succeeded(name, end)
+		}
+	}
+}
+
+// ExpectJob declares that the job called name should succeed at least every interval, so a
+// job that silently stops running can be alerted on. From then on the default registry
+// exports, computed at scrape time:
+//   - job_seconds_since_last_success{job}, counted from the call to ExpectJob until the first success
+//   - job_stale{job}, 1 when the last success is older than interval
+//
+// It returns an error if the interval is not positive or if the collector of these
+// metrics cannot be registered.
+//
+// Example:
+//
+//	prometrics.ExpectJob("nightly-report", 24*time.Hour)
+func ExpectJob(name string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("prometrics: job %q: interval must be positive", name)
+	}
+	jobSchedule.registered.Do(func() {
+		if err := prometheus.DefaultRegisterer.Register(jobSchedule); err != nil {
+			logger().Error("job staleness collector registration failed", "error", err)
+			jobSchedule.err = fmt.Errorf("prometrics: register job staleness collector: %w", err)
+		}
+	})
+	if jobSchedule.err != nil {
+		return jobSchedule.err
+	}
+
+	jobSchedule.mu.Lock()
+	defer jobSchedule.mu.Unlock()
+	jobSchedule.jobs[name] = &expectedJob{interval: interval, since: time.Now()}
+	return nil
+}
+
+type expectedJob struct {
+	interval time.Duration
+	// since is the time of the last success, or of ExpectJob before the first one
+	since time.Time
+}
+
+// jobStaleness is a prometheus.Collector exporting the staleness of the expected jobs.
+type jobStaleness struct {
+	sinceDesc *prometheus.Desc
+	staleDesc *prometheus.Desc
+
+	registered sync.Once
+	// err is the error of the registration of the collector
+	err  error
+	mu   sync.Mutex
+	jobs map[string]*expectedJob
+}
+
+var jobSchedule = &jobStaleness{
+	sinceDesc: prometheus.NewDesc("job_seconds_since_last_success", "Seconds since the last successful run of an expected job", []string{"job"}, nil),
+	staleDesc: prometheus.NewDesc("job_stale", "1 when the last successful run of a job is older than its expected interval", []string{"job"}, nil),
+	jobs:      make(map[string]*expectedJob),
+}
+
+func (s *jobStaleness) succeeded(name string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[name]; ok {
+		j.since = at
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (s *jobStaleness) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.sinceDesc
+	ch <- s.staleDesc
+}
+
+// Collect implements prometheus.Collector.
+func (s *jobStaleness) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.jobs))
+	for name := range s.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		j := s.jobs[name]
+		since := time.Since(j.since)
+		stale := 0.0
+		if since > j.interval {
+			stale = 1
+		}
+		ch <- prometheus.MustNewConstMetric(s.sinceDesc, prometheus.GaugeValue, since.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(s.staleDesc, prometheus.GaugeValue, stale, name)
+	}
+}
@@ -0,0 +1,79 @@
+package prometrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func runTestJob(name string, fail error, panics bool) (err error) {
+	defer TrackJob(name)(&err)
+	if panics {
+		panic("boom")
+	}
+	return fail
+}
+
+func TestTrackJob(t *testing.T) {
+	job := uniqueTestName("test-job")
+	runTestJob(job, nil, false)
+	runTestJob(job, errors.New("upstream down"), false)
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("recovered %v, want the job panic to propagate", r)
+			}
+		}()
+		runTestJob(job, nil, true)
+	}()
+
+	if got := testutil.ToFloat64(JobRunsTotal.WithLabelValues(job)); got != 3 {
+		t.Errorf("runs = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(JobFailuresTotal.WithLabelValues(job, "error")); got != 1 {
+		t.Errorf("errors = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(JobFailuresTotal.WithLabelValues(job, "panic")); got != 1 {
+		t.Errorf("panics = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(JobRunning.WithLabelValues(job)); got != 0 {
+		t.Errorf("running = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(JobLastSuccess.WithLabelValues(job)); got < float64(time.Now().Add(-time.Minute).Unix()) {
+		t.Errorf("last success = %v, want the time of the first run", got)
+	}
+}
+
+func TestExpectJob(t *testing.T) {
+	staleJob, freshJob := uniqueTestName("test-stale"), uniqueTestName("test-fresh")
+	if err := ExpectJob(staleJob, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExpectJob(freshJob, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	runTestJob(freshJob, nil, false)
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(jobSchedule)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := make(map[string]float64)
+	for _, f := range families {
+		if f.GetName() != "job_stale" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			stale[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+		}
+	}
+	if stale[staleJob] != 1 || stale[freshJob] != 0 {
+		t.Errorf("job_stale = %v, want %s 1 and %s 0", stale, staleJob, freshJob)
+	}
+}
@@ -0,0 +1,58 @@
+package prometrics
+
+import (
+	"net/http"
+)
+
+// HttpLabels holds the label values a request is recorded with in http_requests_total,
+// http_request_duration_seconds, http_request_size_bytes and http_response_size_bytes.
+type HttpLabels struct {
+	Path   string
+	Method string
+	Code   string
+}
+
+// LabelTransform rewrites the labels of a request before it is recorded. Transforms run
+// in the order they are configured. Method is the same for every front-end: the lower
+// case standard method, eg. "get", or "OTHER" for a non-standard one.
+//
+// Changing Path only affects the per-request metrics above; in-flight, queue time and
+// stream metrics keep the path of the middleware.
+type LabelTransform func(r *http.Request, labels *HttpLabels)
+
+// WithStatusClass records the code label as a class ("1xx", "2xx", "3xx", "4xx", "5xx")
+// instead of the exact status code.
+func WithStatusClass() HttpOption {
+	return WithLabelTransform(func(_ *http.Request, l *HttpLabels) {
+		if len(l.Code) == 3 {
+			l.Code = l.Code[:1] + "xx"
+		}
+	})
+}
+
+// WithLabelTransform adds a user supplied LabelTransform.
+//
+// Example, recording the route template of gorilla mux instead of a fixed path:
+//
+//	prometrics.WithLabelTransform(func(r *http.Request, l *prometrics.HttpLabels) {
+//	    if route := mux.CurrentRoute(r); route != nil {
+//	        l.Path, _ = route.GetPathTemplate()
+//	    }
+//	})
+func WithLabelTransform(fn LabelTransform) HttpOption {
+	return func(c *httpConfig) {
+		c.transforms = append(c.transforms, fn)
+	}
+}
+
+// transformLabels applies the configured label transforms to o.
+func (c *httpConfig) transformLabels(o *httpObservation) {
+	if len(c.transforms) == 0 {
+		return
+	}
+	l := HttpLabels{Path: o.path, Method: o.method, Code: o.code}
+	for _, fn := range c.transforms {
+		fn(o.request, &l)
+	}
+	o.path, o.method, o.code = l.Path, l.Method, l.Code
+}
@@ -0,0 +1,36 @@
+package prometrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMethodLabelSameForGinAndNetHTTP(t *testing.T) {
+	const path = "/test-method"
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(GinMiddleware())
+	r.Handle("PROPFIND", path, func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET(path, func(c *gin.Context) { c.Status(http.StatusOK) })
+	handler := InstrumentHttpHandler(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	before := map[string]float64{}
+	for _, method := range []string{"get", MethodOther} {
+		before[method] = testutil.ToFloat64(HttpRequestsTotal.WithLabelValues(path, method, "200"))
+	}
+	for _, h := range []http.Handler{r, handler} {
+		for _, method := range []string{http.MethodGet, "PROPFIND"} {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+		}
+	}
+
+	for _, method := range []string{"get", MethodOther} {
+		if got := testutil.ToFloat64(HttpRequestsTotal.WithLabelValues(path, method, "200")) - before[method]; got != 2 {
+			t.Errorf("requests{method=%q} = %v, want 2, one per framework", method, got)
+		}
+	}
+}
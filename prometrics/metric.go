@@ -21,6 +21,11 @@ const (
 	HttpRequestsInFlightMetric HTTPMetricName = "http_requests_in_flight"
 	HttpRequestSizeMetric      HTTPMetricName = "http_request_size_bytes"
 	HttpResponseSizeMetric     HTTPMetricName = "http_response_size_bytes"
+	HttpRequestQueueMetric     HTTPMetricName = "http_request_queue_duration_seconds"
+	HttpStreamsActiveMetric    HTTPMetricName = "http_streams_active"
+	HttpStreamDurationMetric   HTTPMetricName = "http_stream_duration_seconds"
+	HttpStreamMessagesMetric   HTTPMetricName = "http_stream_messages_total"
+	HttpStreamBytesMetric      HTTPMetricName = "http_stream_bytes_total"
 )
 
 var (
@@ -95,4 +100,54 @@ var (
 		Help:    "Size of outgoing HTTP responses in bytes.",
 		Buckets: prometheus.ExponentialBuckets(100, 10, 5),
 	}, []string{"path", "method", "code"})
+
+	// HttpRequestQueueDuration measures the time requests spent queued in a load balancer
+	// or ingress before reaching the Go handler, as reported by X-Request-Start/X-Queue-Start.
+	// It is labeled by request path and uses the same buckets as HttpRequestDuration so both
+	// can be compared directly. It is only recorded when the middleware uses WithQueueTime.
+	//
+	// Metric type: HistogramVec
+	HttpRequestQueueDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    string(HttpRequestQueueMetric),
+		Help:    "Time HTTP requests spent queued upstream before being handled, in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"path"})
+
+	// HttpStreamsActive reports the number of long-lived streams (WebSocket, SSE, hijacked
+	// connections...) currently open, labeled by path and stream kind.
+	//
+	// Metric type: GaugeVec
+	HttpStreamsActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: string(HttpStreamsActiveMetric),
+		Help: "Number of long-lived HTTP streams currently open.",
+	}, []string{"path", "kind"})
+
+	// HttpStreamDuration measures the lifetime of long-lived streams in seconds, labeled by
+	// path and stream kind. Its exponential buckets range from 1 second to about 4.5 hours.
+	//
+	// Metric type: HistogramVec
+	HttpStreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    string(HttpStreamDurationMetric),
+		Help:    "Lifetime of long-lived HTTP streams in seconds.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"path", "kind"})
+
+	// HttpStreamMessages counts the messages exchanged over streams, labeled by path,
+	// stream kind and direction ("sent" or "received"). Messages are counted by the
+	// application through the Stream returned by StreamFromContext.
+	//
+	// Metric type: CounterVec
+	HttpStreamMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: string(HttpStreamMessagesMetric),
+		Help: "Total messages exchanged over long-lived HTTP streams.",
+	}, []string{"path", "kind", "direction"})
+
+	// HttpStreamBytes counts the bytes exchanged over streams, labeled by path, stream
+	// kind and direction ("sent" or "received").
+	//
+	// Metric type: CounterVec
+	HttpStreamBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: string(HttpStreamBytesMetric),
+		Help: "Total bytes exchanged over long-lived HTTP streams.",
+	}, []string{"path", "kind", "direction"})
 )
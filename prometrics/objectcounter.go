@@ -0,0 +1,254 @@
+package prometrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CrudObjectCountErrors counts the failed evaluations of object counters registered with
+// RegisterObjectCounter, labeled by object type and failure type (error, timeout).
+//
+// Metric type: CounterVec
+var CrudObjectCountErrors = CreateCounter("object_count_errors_total", "Total failed object count evaluations", []string{"object", "type"})
+
+// CountFunc returns the current number of objects of a type from the source of truth,
+// eg. a SELECT COUNT(*).
+type CountFunc func(ctx context.Context) (float64, error)
+
+// ObjectCounterOption configures an object counter.
+type ObjectCounterOption func(*objectCounter)
+
+// WithCountInterval evaluates the counter in the background every interval on the
+// DefaultScheduler instead of at scrape time, scrapes then export the last value.
+// Use it for counts that are too slow to run on every scrape. The DefaultScheduler must
+// be running, see RunPeriodicCollectors, otherwise no value is ever exported.
+func WithCountInterval(interval time.Duration) ObjectCounterOption {
+	return func(c *objectCounter) {
+		c.interval = interval
+	}
+}
+
+// WithCountCacheTTL sets how long the value of a counter evaluated at scrape time is reused
+// by the following scrapes. The default is 15 seconds, a TTL of 0 evaluates the counter on
+// every scrape.
+func WithCountCacheTTL(ttl time.Duration) ObjectCounterOption {
+	return func(c *objectCounter) {
+		c.ttl = ttl
+	}
+}
+
+// WithCountTimeout sets how long an evaluation may take before it is abandoned and
+// counted as a timeout. The count function gets a context cancelled after the timeout, a
+// function ignoring it is not evaluated again until it returns. The default is 5 seconds.
+func WithCountTimeout(timeout time.Duration) ObjectCounterOption {
+	return func(c *objectCounter) {
+		c.timeout = timeout
+	}
+}
+
+type objectCounter struct {
+	object   string
+	fn       CountFunc
+	interval time.Duration
+	ttl      time.Duration
+	timeout  time.Duration
+
+	mu        sync.Mutex
+	value     float64
+	ok        bool
+	running   bool
+	evaluated time.Time
+}
+
+// objectCounters is a prometheus.Collector exporting object_count for the registered
+// object counters. It is unchecked (Describe sends nothing), so its series are merged
+// with the ones of CrudObjectCount into the same metric family.
+type objectCounters struct {
+	desc *prometheus.Desc
+
+	mu       sync.Mutex
+	counters map[string]*objectCounter
+}
+
+var (
+	defaultObjectCounters = &objectCounters{
+		desc:     prometheus.NewDesc("object_count", "Current number of objects", []string{"object"}, nil),
+		counters: make(map[string]*objectCounter),
+	}
+	objectCountersRegistered sync.Once
+	objectCountersErr        error
+)
+
+// RegisterObjectCounter makes object_count{object} reflect the value returned by fn, so the
+// gauge cannot drift from the source of truth like it does when a code path forgets to call
+// IncObjectCount. fn is evaluated at scrape time, at most once per WithCountCacheTTL, or
+// periodically with WithCountInterval.
+// A failed evaluation, including a panic of fn, is counted in object_count_errors_total
+// and the last good value, if any, is exported instead.
+//
+// Once a counter is registered for object, SetObjectCount, IncObjectCount and
+// DecObjectCount do nothing for it.
+//
+// Example:
+//
+//	prometrics.RegisterObjectCounter("person", func(ctx context.Context) (float64, error) {
+//	    var n float64
+//	    err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM person").Scan(&n)
+//	    return n, err
+//	}, prometrics.WithCountInterval(time.Minute))
+func RegisterObjectCounter(object string, fn CountFunc, opts ...ObjectCounterOption) error {
+	if fn == nil {
+		return fmt.Errorf("prometrics: object counter %q: nil count function", object)
+	}
+	c := &objectCounter{object: object, fn: fn, ttl: 15 * time.Second, timeout: 5 * time.Second}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	objectCountersRegistered.Do(func() {
+		if err := prometheus.DefaultRegisterer.Register(defaultObjectCounters); err != nil {
+			logger().Error("object counters registration failed", "error", err)
+			objectCountersErr = fmt.Errorf("prometrics: register object counters: %w", err)
+		}
+	})
+	if objectCountersErr != nil {
+		return objectCountersErr
+	}
+
+	oc := defaultObjectCounters
+	oc.mu.Lock()
+	if _, ok := oc.counters[object]; ok {
+		oc.mu.Unlock()
+		return fmt.Errorf("prometrics: object counter %q already registered", object)
+	}
+	oc.counters[object] = c
+	// the series would collide with the one of the counter, see updateObjectCount
+	CrudObjectCount.DeleteLabelValues(object)
+	oc.mu.Unlock()
+
+	if c.interval > 0 {
+		return RegisterPeriodicCollector("object_count_"+object, c.interval, func(ctx context.Context) error {
+			return c.evaluate(ctx)
+		}, WithTimeout(c.timeout))
+	}
+	return nil
+}
+
+// updateObjectCount calls update with the object_count gauge of object, unless a counter
+// is registered for object. The check and the update hold the lock of the counters, so a
+// concurrent RegisterObjectCounter cannot leave the gauge series next to the counter.
+func updateObjectCount(object string, update func(g prometheus.Gauge)) {
+	oc := defaultObjectCounters
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	if _, ok := oc.counters[object]; !ok {
+		update(CrudObjectCount.WithLabelValues(object))
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (oc *objectCounters) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (oc *objectCounters) Collect(ch chan<- prometheus.Metric) {
+	oc.mu.Lock()
+	counters := make([]*objectCounter, 0, len(oc.counters))
+	for _, c := range oc.counters {
+		counters = append(counters, c)
+	}
+	oc.mu.Unlock()
+	sort.Slice(counters, func(i, j int) bool { return counters[i].object < counters[j].object })
+
+	var wg sync.WaitGroup
+	for _, c := range counters {
+		if c.interval > 0 || !c.expired() {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// failures are counted, the last good value is exported
+			_ = c.evaluate(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	for _, c := range counters {
+		c.mu.Lock()
+		value, ok := c.value, c.ok
+		c.mu.Unlock()
+		if ok {
+			ch <- prometheus.MustNewConstMetric(oc.desc, prometheus.GaugeValue, value, c.object)
+		}
+	}
+}
+
+// expired reports whether the value evaluated at scrape time is older than the TTL.
+func (c *objectCounter) expired() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Since(c.evaluated) >= c.ttl
+}
+
+// evaluate runs the count function and stores its value. It does nothing while the count
+// function of a previous evaluation is still running.
+func (c *objectCounter) evaluate(ctx context.Context) error {
+	c.mu.Lock()
+	if c.running {
+		c.mu.Unlock()
+		return nil
+	}
+	c.running, c.evaluated = true, time.Now()
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type result struct {
+		value float64
+		err   error
+	}
+	// a count function ignoring its context must not block the scrape
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			r := recover()
+			c.mu.Lock()
+			c.running = false
+			c.mu.Unlock()
+			if r != nil {
+				done <- result{err: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+		value, err := c.fn(ctx)
+		done <- result{value, err}
+	}()
+
+	var value float64
+	var err error
+	select {
+	case r := <-done:
+		value, err = r.value, r.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		failure := "error"
+		if errors.Is(err, context.DeadlineExceeded) {
+			failure = "timeout"
+		}
+		CrudObjectCountErrors.WithLabelValues(c.object, failure).Inc()
+		return fmt.Errorf("count %s: %w", c.object, err)
+	}
+
+	c.mu.Lock()
+	c.value, c.ok = value, true
+	c.mu.Unlock()
+	return nil
+}
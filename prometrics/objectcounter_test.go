@@ -0,0 +1,188 @@
+package prometrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func objectCount(t *testing.T, object string) (float64, bool) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "object_count" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if m.GetLabel()[0].GetValue() == object {
+				return m.GetGauge().GetValue(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestRegisterObjectCounter(t *testing.T) {
+	widget, other := uniqueTestName("test-widget"), uniqueTestName("test-other")
+	SetObjectCount(other, 3)
+	SetObjectCount(widget, 99)
+
+	count := 7.0
+	var fail error
+	err := RegisterObjectCounter(widget, func(ctx context.Context) (float64, error) {
+		return count, fail
+	}, WithCountCacheTTL(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterObjectCounter(widget, func(ctx context.Context) (float64, error) { return 0, nil }); err == nil {
+		t.Error("registering a counter twice should fail")
+	}
+
+	// the helpers must not bring back the series of the gauge
+	SetObjectCount(widget, 99)
+	IncObjectCount(widget)
+	if got, _ := objectCount(t, widget); got != 7 {
+		t.Errorf("object_count{%s} = %v, want 7", widget, got)
+	}
+	if got, _ := objectCount(t, other); got != 3 {
+		t.Errorf("object_count{%s} = %v, want 3 from SetObjectCount", other, got)
+	}
+
+	count, fail = 8, errors.New("db down")
+	if got, _ := objectCount(t, widget); got != 7 {
+		t.Errorf("object_count{%s} = %v, want the last good value 7", widget, got)
+	}
+	if got := testutil.ToFloat64(CrudObjectCountErrors.WithLabelValues(widget, "error")); got != 1 {
+		t.Errorf("errors{error} = %v, want 1", got)
+	}
+}
+
+func TestRegisterObjectCounterInvalid(t *testing.T) {
+	if err := RegisterObjectCounter(uniqueTestName("test-nil"), nil); err == nil {
+		t.Error("registering a nil count function should fail")
+	}
+
+	object := uniqueTestName("test-panic")
+	if err := RegisterObjectCounter(object, func(ctx context.Context) (float64, error) {
+		panic("boom")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objectCount(t, object); ok {
+		t.Errorf("object_count{%s} exported without a value", object)
+	}
+	if got := testutil.ToFloat64(CrudObjectCountErrors.WithLabelValues(object, "error")); got != 1 {
+		t.Errorf("errors{error} = %v, want 1 for the panic", got)
+	}
+}
+
+func TestRegisterObjectCounterTimeout(t *testing.T) {
+	object := uniqueTestName("test-slow")
+	block := make(chan struct{})
+	defer close(block)
+	err := RegisterObjectCounter(object, func(ctx context.Context) (float64, error) {
+		<-block
+		return 1, nil
+	}, WithCountTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := objectCount(t, object); ok {
+		t.Errorf("object_count{%s} exported without a value", object)
+	}
+	if got := testutil.ToFloat64(CrudObjectCountErrors.WithLabelValues(object, "timeout")); got < 1 {
+		t.Errorf("errors{timeout} = %v, want at least 1", got)
+	}
+}
+
+func TestRegisterObjectCounterCacheTTL(t *testing.T) {
+	object := uniqueTestName("test-cached")
+	var calls atomic.Int64
+	err := RegisterObjectCounter(object, func(ctx context.Context) (float64, error) {
+		return float64(calls.Add(1)), nil
+	}, WithCountCacheTTL(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got, _ := objectCount(t, object); got != 1 {
+			t.Errorf("scrape %d: object_count{%s} = %v, want the cached value 1", i, object, got)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("count function called %d times, want 1", got)
+	}
+}
+
+func TestRegisterObjectCounterStillRunning(t *testing.T) {
+	object := uniqueTestName("test-stuck")
+	block := make(chan struct{})
+	defer close(block)
+	var calls atomic.Int64
+	err := RegisterObjectCounter(object, func(ctx context.Context) (float64, error) {
+		calls.Add(1)
+		<-block // ignores ctx
+		return 1, nil
+	}, WithCountTimeout(10*time.Millisecond), WithCountCacheTTL(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		objectCount(t, object)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("count function called %d times while still running, want 1", got)
+	}
+}
+
+func TestRegisterObjectCounterConcurrentHelpers(t *testing.T) {
+	object := uniqueTestName("test-race")
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					IncObjectCount(object)
+				}
+			}
+		}()
+	}
+	err := RegisterObjectCounter(object, func(ctx context.Context) (float64, error) { return 1, nil }, WithCountInterval(time.Hour))
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(CrudObjectCount)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			if m.GetLabel()[0].GetValue() == object {
+				t.Errorf("object_count{%s} gauge series came back after RegisterObjectCounter", object)
+			}
+		}
+	}
+}
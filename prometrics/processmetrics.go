@@ -0,0 +1,211 @@
+package prometrics
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	psnet "github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
+)
+
+// HealthOption configures the HealthCollector created by NewHealthCollector and
+// RegisterHealthCollector.
+type HealthOption func(*HealthCollector)
+
+// healthFamily is an optional group of metrics of the HealthCollector.
+// Every family is read on its own, so only enabled families cost anything.
+type healthFamily struct {
+	name    string
+	descs   []*prometheus.Desc
+	collect func(ch chan<- prometheus.Metric) error
+}
+
+// processFamily is a healthFamily read from gopsutil for the current process.
+type processFamily struct {
+	name    string
+	descs   []*prometheus.Desc
+	collect func(p *process.Process, ch chan<- prometheus.Metric) error
+}
+
+// WithProcessMemory exports the resident and virtual memory size of the process:
+//   - app_process_resident_memory_bytes
+//   - app_process_virtual_memory_bytes
+func WithProcessMemory() HealthOption {
+	rss := prometheus.NewDesc("app_process_resident_memory_bytes", "Resident memory size of the process in bytes.", nil, nil)
+	vms := prometheus.NewDesc("app_process_virtual_memory_bytes", "Virtual memory size of the process in bytes.", nil, nil)
+	return withProcessFamily(processFamily{
+		name:  "memory",
+		descs: []*prometheus.Desc{rss, vms},
+		collect: func(p *process.Process, ch chan<- prometheus.Metric) error {
+			mem, err := p.MemoryInfo()
+			if err != nil {
+				return err
+			}
+			ch <- prometheus.MustNewConstMetric(rss, prometheus.GaugeValue, float64(mem.RSS))
+			ch <- prometheus.MustNewConstMetric(vms, prometheus.GaugeValue, float64(mem.VMS))
+			return nil
+		},
+	})
+}
+
+// WithFileDescriptors exports the open file descriptors of the process and their limit:
+//   - app_process_open_fds
+//   - app_process_max_fds
+func WithFileDescriptors() HealthOption {
+	open := prometheus.NewDesc("app_process_open_fds", "Number of open file descriptors.", nil, nil)
+	maxFds := prometheus.NewDesc("app_process_max_fds", "Maximum number of open file descriptors (soft limit).", nil, nil)
+	return withProcessFamily(processFamily{
+		name:  "fds",
+		descs: []*prometheus.Desc{open, maxFds},
+		collect: func(p *process.Process, ch chan<- prometheus.Metric) error {
+			n, err := p.NumFDs()
+			if err != nil {
+				return err
+			}
+			ch <- prometheus.MustNewConstMetric(open, prometheus.GaugeValue, float64(n))
+
+			limits, err := p.Rlimit()
+			if err != nil {
+				return err
+			}
+			for _, l := range limits {
+				// a negative soft limit means unlimited
+				if l.Resource == process.RLIMIT_NOFILE && l.Soft >= 0 {
+					ch <- prometheus.MustNewConstMetric(maxFds, prometheus.GaugeValue, float64(l.Soft))
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// WithThreads exports the number of OS threads of the process:
+//   - app_process_threads
+func WithThreads() HealthOption {
+	threads := prometheus.NewDesc("app_process_threads", "Number of OS threads of the process.", nil, nil)
+	return withProcessFamily(processFamily{
+		name:  "threads",
+		descs: []*prometheus.Desc{threads},
+		collect: func(p *process.Process, ch chan<- prometheus.Metric) error {
+			n, err := p.NumThreads()
+			if err != nil {
+				return err
+			}
+			ch <- prometheus.MustNewConstMetric(threads, prometheus.GaugeValue, float64(n))
+			return nil
+		},
+	})
+}
+
+// WithContextSwitches exports the context switches of the process by type (voluntary, involuntary):
+//   - app_process_context_switches_total{type}
+func WithContextSwitches() HealthOption {
+	switches := prometheus.NewDesc("app_process_context_switches_total", "Total context switches of the process.", []string{"type"}, nil)
+	return withProcessFamily(processFamily{
+		name:  "context_switches",
+		descs: []*prometheus.Desc{switches},
+		collect: func(p *process.Process, ch chan<- prometheus.Metric) error {
+			cs, err := p.NumCtxSwitches()
+			if err != nil {
+				return err
+			}
+			ch <- prometheus.MustNewConstMetric(switches, prometheus.CounterValue, float64(cs.Voluntary), "voluntary")
+			ch <- prometheus.MustNewConstMetric(switches, prometheus.CounterValue, float64(cs.Involuntary), "involuntary")
+			return nil
+		},
+	})
+}
+
+// WithProcessIO exports the disk I/O of the process:
+//   - app_process_io_read_bytes_total
+//   - app_process_io_write_bytes_total
+//   - app_process_io_read_ops_total
+//   - app_process_io_write_ops_total
+func WithProcessIO() HealthOption {
+	readBytes := prometheus.NewDesc("app_process_io_read_bytes_total", "Total bytes read by the process.", nil, nil)
+	writeBytes := prometheus.NewDesc("app_process_io_write_bytes_total", "Total bytes written by the process.", nil, nil)
+	readOps := prometheus.NewDesc("app_process_io_read_ops_total", "Total read operations of the process.", nil, nil)
+	writeOps := prometheus.NewDesc("app_process_io_write_ops_total", "Total write operations of the process.", nil, nil)
+	return withProcessFamily(processFamily{
+		name:  "io",
+		descs: []*prometheus.Desc{readBytes, writeBytes, readOps, writeOps},
+		collect: func(p *process.Process, ch chan<- prometheus.Metric) error {
+			stat, err := p.IOCounters()
+			if err != nil {
+				return err
+			}
+			ch <- prometheus.MustNewConstMetric(readBytes, prometheus.CounterValue, float64(stat.ReadBytes))
+			ch <- prometheus.MustNewConstMetric(writeBytes, prometheus.CounterValue, float64(stat.WriteBytes))
+			ch <- prometheus.MustNewConstMetric(readOps, prometheus.CounterValue, float64(stat.ReadCount))
+			ch <- prometheus.MustNewConstMetric(writeOps, prometheus.CounterValue, float64(stat.WriteCount))
+			return nil
+		},
+	})
+}
+
+// WithTCPConnections exports the TCP connections of the process by state (ESTABLISHED, TIME_WAIT...):
+//   - app_process_tcp_connections{state}
+//
+// Listing connections walks the file descriptors of the process, which can be costly
+// for processes with many connections.
+func WithTCPConnections() HealthOption {
+	conns := prometheus.NewDesc("app_process_tcp_connections", "Number of TCP connections of the process by state.", []string{"state"}, nil)
+	return withProcessFamily(processFamily{
+		name:  "tcp_connections",
+		descs: []*prometheus.Desc{conns},
+		collect: func(p *process.Process, ch chan<- prometheus.Metric) error {
+			stats, err := psnet.ConnectionsPid("tcp", p.Pid)
+			if err != nil {
+				return err
+			}
+			byState := make(map[string]int)
+			for _, s := range stats {
+				byState[s.Status]++
+			}
+			for state, n := range byState {
+				ch <- prometheus.MustNewConstMetric(conns, prometheus.GaugeValue, float64(n), state)
+			}
+			return nil
+		},
+	})
+}
+
+// WithAllProcessMetrics enables every optional process metric family. It can be combined
+// with the options of single families, a family is only enabled once.
+func WithAllProcessMetrics() HealthOption {
+	opts := []HealthOption{WithProcessMemory(), WithFileDescriptors(), WithThreads(), WithContextSwitches(), WithProcessIO(), WithTCPConnections()}
+	return func(c *HealthCollector) {
+		for _, opt := range opts {
+			opt(c)
+		}
+	}
+}
+
+// addFamily enables f. A family enabled again, eg. by WithAllProcessMetrics and
+// WithFileDescriptors, replaces the previous one, so its metrics are not described twice.
+func (c *HealthCollector) addFamily(f healthFamily) {
+	for i := range c.families {
+		if c.families[i].name == f.name {
+			c.families[i] = f
+			return
+		}
+	}
+	c.families = append(c.families, f)
+}
+
+var errNoProcess = errors.New("prometrics: no process handle")
+
+func withProcessFamily(f processFamily) HealthOption {
+	return func(c *HealthCollector) {
+		c.addFamily(healthFamily{
+			name:  "process_" + f.name,
+			descs: f.descs,
+			collect: func(ch chan<- prometheus.Metric) error {
+				if c.proc == nil {
+					return errNoProcess
+				}
+				return f.collect(c.proc, ch)
+			},
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package prometrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProfileCapturesTotal counts the profiles written by the ProfileCapturer, labeled by
+// profile kind (heap, goroutine, cpu) and the threshold that triggered the capture.
+//
+// Metric type: CounterVec
+var ProfileCapturesTotal = CreateCounter("app_profile_captures_total", "Total profiles captured after a resource threshold was exceeded.", []string{"kind", "reason"})
+
+// Profile kinds written by the ProfileCapturer.
+const (
+	ProfileHeap      = "heap"
+	ProfileGoroutine = "goroutine"
+	ProfileCPU       = "cpu"
+)
+
+// ProfileOption configures a ProfileCapturer.
+type ProfileOption func(*ProfileCapturer)
+
+// WithMemoryThreshold captures a heap profile when app_allocated_memory exceeds bytes.
+func WithMemoryThreshold(bytes uint64) ProfileOption {
+	return func(p *ProfileCapturer) {
+		p.memory = bytes
+	}
+}
+
+// WithGoroutineThreshold captures a goroutine profile when the number of goroutines exceeds n.
+func WithGoroutineThreshold(n int) ProfileOption {
+	return func(p *ProfileCapturer) {
+		p.goroutines = n
+	}
+}
+
+// WithCPUThreshold captures a CPU profile when the CPU usage of the process exceeds percent
+// (of one core, as app_cpu_usage_percent).
+func WithCPUThreshold(percent float64) ProfileOption {
+	return func(p *ProfileCapturer) {
+		p.cpu = percent
+	}
+}
+
+// WithCPUProfileDuration sets how long CPU profiles run. The default is 10 seconds.
+func WithCPUProfileDuration(d time.Duration) ProfileOption {
+	return func(p *ProfileCapturer) {
+		p.cpuDuration = d
+	}
+}
+
+// WithCaptureCooldown sets the minimum time between two captures of the same kind.
+// The default is 5 minutes.
+func WithCaptureCooldown(d time.Duration) ProfileOption {
+	return func(p *ProfileCapturer) {
+		p.cooldown = d
+	}
+}
+
+// WithProfileHealthCollector evaluates the thresholds against the values of c, eg. a
+// HealthCollector registered with a custom registry. By default the HealthCollector of
+// the default registry is used, and registered if needed.
+func WithProfileHealthCollector(c *HealthCollector) ProfileOption {
+	return func(p *ProfileCapturer) {
+		p.health = c
+	}
+}
+
+// WithProfileRetention sets how many profiles of each kind are kept in the directory,
+// older ones are deleted. The default is 10.
+func WithProfileRetention(n int) ProfileOption {
+	return func(p *ProfileCapturer) {
+		p.retention = n
+	}
+}
+
+// ProfileCapturer writes pprof profiles to a directory when the application health values
+// cross configured thresholds, so the profile of a spike is at hand even when it is gone by
+// the time someone attaches pprof. Thresholds are evaluated against the values computed by
+// the HealthCollector exporting the health metrics, so they match what /metrics shows:
+// app_allocated_memory triggers heap profiles, app_go_routines goroutine profiles and
+// app_cpu_usage_percent CPU profiles. The CPU usage is measured since the previous check,
+// the capturer keeps its own baseline so checks do not change the exported CPU usage.
+//
+// Captures are rate limited by a cooldown per kind, started by a successful capture, and
+// only the latest profiles of each kind are kept. Profiles are named <kind>-<UTC timestamp>.pb.gz and can be opened with
+// `go tool pprof`.
+type ProfileCapturer struct {
+	dir         string
+	memory      uint64
+	goroutines  int
+	cpu         float64
+	cpuDuration time.Duration
+	cooldown    time.Duration
+	retention   int
+	health      *HealthCollector
+	cpuUsage    cpuMeter
+
+	mu        sync.Mutex
+	last      map[string]time.Time
+	capturing map[string]bool
+}
+
+// NewProfileCapturer creates a ProfileCapturer writing to dir, which is created if needed.
+// Its Check method is a CollectFunc that can be registered with a Scheduler.
+func NewProfileCapturer(dir string, opts ...ProfileOption) (*ProfileCapturer, error) {
+	p := &ProfileCapturer{
+		dir:         dir,
+		cpuDuration: 10 * time.Second,
+		cooldown:    5 * time.Minute,
+		retention:   10,
+		last:        make(map[string]time.Time),
+		capturing:   make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("prometrics: profile directory: %w", err)
+	}
+	if p.health == nil {
+		p.health = registerDefaultHealthCollector()
+	}
+	p.cpuUsage = newCPUMeter()
+	return p, nil
+}
+
+// RegisterProfileCapture creates a ProfileCapturer and registers it as the "profile_capture"
+// periodic collector of the DefaultScheduler, checking the thresholds every interval.
+//
+// Example:
+//
+//	prometrics.RegisterProfileCapture("/var/tmp/profiles", 15*time.Second,
+//	    prometrics.WithMemoryThreshold(1<<30),
+//	    prometrics.WithGoroutineThreshold(10000),
+//	    prometrics.WithCPUThreshold(150))
+func RegisterProfileCapture(dir string, interval time.Duration, opts ...ProfileOption) error {
+	p, err := NewProfileCapturer(dir, opts...)
+	if err != nil {
+		return err
+	}
+	// a CPU profile must be able to run to its end
+	return RegisterPeriodicCollector("profile_capture", interval, p.Check, WithTimeout(interval+p.cpuDuration))
+}
+
+// Check evaluates the thresholds once and captures the profiles whose threshold is exceeded.
+func (p *ProfileCapturer) Check(ctx context.Context) error {
+	v := p.health.valuesWith(&p.cpuUsage)
+
+	var errs []error
+	if p.memory > 0 && v.MemoryAlloc > p.memory {
+		errs = append(errs, p.capture(ctx, ProfileHeap, "memory"))
+	}
+	if p.goroutines > 0 && v.Goroutines > p.goroutines {
+		errs = append(errs, p.capture(ctx, ProfileGoroutine, "goroutines"))
+	}
+	if p.cpu > 0 && v.CPUValid && v.CPUPercent > p.cpu {
+		errs = append(errs, p.capture(ctx, ProfileCPU, "cpu"))
+	}
+	return errors.Join(errs...)
+}
+
+// capture writes a profile of kind unless one was captured within the cooldown or is
+// being captured. A failed capture does not start the cooldown.
+func (p *ProfileCapturer) capture(ctx context.Context, kind, reason string) error {
+	now := time.Now()
+	p.mu.Lock()
+	if last, ok := p.last[kind]; p.capturing[kind] || (ok && now.Sub(last) < p.cooldown) {
+		p.mu.Unlock()
+		return nil
+	}
+	p.capturing[kind] = true
+	p.mu.Unlock()
+
+	err := p.write(ctx, kind, now)
+	p.mu.Lock()
+	delete(p.capturing, kind)
+	if err == nil {
+		p.last[kind] = now
+	}
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ProfileCapturesTotal.WithLabelValues(kind, reason).Inc()
+	return p.prune(kind)
+}
+
+// write writes a profile of kind to a new file of the directory.
+func (p *ProfileCapturer) write(ctx context.Context, kind string, now time.Time) error {
+	name := filepath.Join(p.dir, fmt.Sprintf("%s-%s.pb.gz", kind, now.UTC().Format("20060102T150405.000000000Z")))
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("capture %s profile: %w", kind, err)
+	}
+	if err = writeProfile(ctx, f, kind, p.cpuDuration); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+		os.Remove(name)
+	}
+	if err != nil {
+		return fmt.Errorf("capture %s profile: %w", kind, err)
+	}
+	return nil
+}
+
+func writeProfile(ctx context.Context, f *os.File, kind string, cpuDuration time.Duration) error {
+	if kind != ProfileCPU {
+		return pprof.Lookup(kind).WriteTo(f, 0)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		return err
+	}
+	timer := time.NewTimer(cpuDuration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	pprof.StopCPUProfile()
+	return nil
+}
+
+// prune deletes the oldest profiles of kind beyond the retention.
+func (p *ProfileCapturer) prune(kind string) error {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), kind+"-") && strings.HasSuffix(e.Name(), ".pb.gz") {
+			names = append(names, e.Name())
+		}
+	}
+	// the timestamps sort chronologically
+	sort.Strings(names)
+	for len(names) > p.retention {
+		if err := os.Remove(filepath.Join(p.dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
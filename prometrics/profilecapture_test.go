@@ -0,0 +1,98 @@
+package prometrics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProfileCapturer(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewProfileCapturer(dir, WithMemoryThreshold(1), WithGoroutineThreshold(1), WithProfileRetention(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := testutil.ToFloat64(ProfileCapturesTotal.WithLabelValues(ProfileHeap, "memory"))
+	for i := 0; i < 2; i++ {
+		if err := p.Check(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := countProfiles(t, dir, ProfileHeap); got != 1 {
+		t.Errorf("heap profiles = %d, want 1 within the cooldown", got)
+	}
+	if got := countProfiles(t, dir, ProfileGoroutine); got != 1 {
+		t.Errorf("goroutine profiles = %d, want 1 within the cooldown", got)
+	}
+	if got := testutil.ToFloat64(ProfileCapturesTotal.WithLabelValues(ProfileHeap, "memory")) - before; got != 1 {
+		t.Errorf("heap captures = %v, want 1", got)
+	}
+
+	p.cooldown = 0
+	for i := 0; i < 3; i++ {
+		if err := p.Check(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := countProfiles(t, dir, ProfileHeap); got != 2 {
+		t.Errorf("heap profiles = %d, want 2 after pruning", got)
+	}
+}
+
+func countProfiles(t *testing.T, dir, kind string) int {
+	matches, err := filepath.Glob(filepath.Join(dir, kind+"-*.pb.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range matches {
+		if fi, err := os.Stat(m); err != nil || fi.Size() == 0 {
+			t.Errorf("profile %s is empty", m)
+		}
+	}
+	return len(matches)
+}
+
+func TestProfileCapturerFailureDoesNotStartCooldown(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "profiles")
+	p, err := NewProfileCapturer(dir, WithGoroutineThreshold(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.health != registerDefaultHealthCollector() {
+		t.Error("the capturer does not use the health collector of the default registry")
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check(context.Background()); err == nil {
+		t.Fatal("Check succeeded without a profile directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := countProfiles(t, dir, ProfileGoroutine); got != 1 {
+		t.Errorf("goroutine profiles = %d, want 1, a failed capture must not start the cooldown", got)
+	}
+}
+
+func TestProfileCapturerLeavesHealthCollector(t *testing.T) {
+	c := NewHealthCollector()
+	p, err := NewProfileCapturer(t.TempDir(), WithProfileHealthCollector(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.cpuUsage.sampled {
+		t.Error("Check moved the CPU usage window of the health collector")
+	}
+}
@@ -0,0 +1,166 @@
+package prometrics
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"time"
+)
+
+var (
+	// ProxyRequestsTotal counts the requests sent to upstreams by an instrumented
+	// httputil.ReverseProxy, labeled by upstream name, HTTP method, as recorded by
+	// InstrumentHttpHandler, and response status code, or "error" when the round trip failed.
+	//
+	// Metric type: CounterVec
+	ProxyRequestsTotal = CreateCounter("proxy_upstream_requests_total", "Total upstream requests of the reverse proxy by response code.", []string{"upstream", "method", "code"})
+	// ProxyRequestDuration measures the time until upstream response headers are received,
+	// labeled by upstream name and HTTP method. Failed round trips are observed as well.
+	//
+	// Metric type: HistogramVec
+	ProxyRequestDuration = CreateHistogram("proxy_upstream_request_duration_seconds", "Upstream round trip latency of the reverse proxy in seconds.", []string{"upstream", "method"}, nil)
+	// ProxyErrorsTotal counts the errors handled by the reverse proxy ErrorHandler,
+	// labeled by upstream name and error type (dial, timeout, canceled, modify_response, other).
+	//
+	// Metric type: CounterVec
+	ProxyErrorsTotal = CreateCounter("proxy_upstream_errors_total", "Total reverse proxy errors by type.", []string{"upstream", "type"})
+)
+
+// ProxyOption configures InstrumentReverseProxy.
+type ProxyOption func(*proxyConfig)
+
+type proxyConfig struct {
+	upstream func(*http.Request) string
+}
+
+// WithUpstreamName sets a fixed upstream label for every proxied request.
+func WithUpstreamName(name string) ProxyOption {
+	return func(c *proxyConfig) {
+		c.upstream = func(*http.Request) string { return name }
+	}
+}
+
+// WithUpstreamFunc derives the upstream label from the outgoing request,
+// eg. for proxies that route to several backends.
+func WithUpstreamFunc(fn func(*http.Request) string) ProxyOption {
+	return func(c *proxyConfig) {
+		c.upstream = fn
+	}
+}
+
+// InstrumentReverseProxy hooks the Transport, ModifyResponse and ErrorHandler of p to record
+// per-upstream request counts, latencies, response codes and proxy errors by type.
+// The existing hooks of p, if any, are kept and called by the instrumented ones.
+//
+// The upstream label is the host of the outgoing request, unless configured with
+// WithUpstreamName or WithUpstreamFunc. It is independent of the inbound path label,
+// so the proxy handler itself can still be wrapped with InstrumentHttpHandler.
+//
+// A proxy is only instrumented once, calling InstrumentReverseProxy again on it has no
+// effect.
+//
+// Example:
+//
+//	proxy := httputil.NewSingleHostReverseProxy(target)
+//	prometrics.InstrumentReverseProxy(proxy, prometrics.WithUpstreamName("users-api"))
+//	http.Handle("/users/", prometrics.InstrumentHttpHandler("/users/", proxy))
+func InstrumentReverseProxy(p *httputil.ReverseProxy, opts ...ProxyOption) *httputil.ReverseProxy {
+	cfg := &proxyConfig{
+		upstream: func(r *http.Request) string { return r.URL.Host },
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	transport := p.Transport
+	if _, ok := transport.(*proxyTransport); ok {
+		return p
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	p.Transport = &proxyTransport{cfg: cfg, next: transport}
+
+	modify := p.ModifyResponse
+	p.ModifyResponse = func(resp *http.Response) error {
+		if modify == nil {
+			return nil
+		}
+		if err := modify(resp); err != nil {
+			return &modifyResponseError{err: err}
+		}
+		return nil
+	}
+
+	errorHandler := p.ErrorHandler
+	p.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		ProxyErrorsTotal.WithLabelValues(cfg.upstream(r), proxyErrorType(err)).Inc()
+		if errorHandler != nil {
+			var me *modifyResponseError
+			if errors.As(err, &me) {
+				err = me.err
+			}
+			errorHandler(w, r, err)
+			return
+		}
+		// same as the default behaviour of httputil.ReverseProxy
+		if p.ErrorLog != nil {
+			p.ErrorLog.Printf("http: proxy error: %v", err)
+		} else {
+			log.Printf("http: proxy error: %v", err)
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	return p
+}
+
+type proxyTransport struct {
+	cfg  *proxyConfig
+	next http.RoundTripper
+}
+
+func (t *proxyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(r)
+	upstream, method := t.cfg.upstream(r), sanitizeMethod(r.Method)
+	ProxyRequestDuration.WithLabelValues(upstream, method).Observe(time.Since(start).Seconds())
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	ProxyRequestsTotal.WithLabelValues(upstream, method, code).Inc()
+	return resp, err
+}
+
+// modifyResponseError marks errors returned by the user supplied ModifyResponse hook.
+type modifyResponseError struct {
+	err error
+}
+
+func (e *modifyResponseError) Error() string { return e.err.Error() }
+func (e *modifyResponseError) Unwrap() error { return e.err }
+
+// proxyErrorType classifies a reverse proxy error into a small, bounded set of label values.
+func proxyErrorType(err error) string {
+	var me *modifyResponseError
+	if errors.As(err, &me) {
+		return "modify_response"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return "dial"
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return "timeout"
+	}
+	return "other"
+}
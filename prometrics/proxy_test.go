@@ -0,0 +1,110 @@
+package prometrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentReverseProxy(t *testing.T) {
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer users.Close()
+	orders := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer orders.Close()
+
+	usersName, ordersName := uniqueTestName("test-users"), uniqueTestName("test-orders")
+	usersURL, _ := url.Parse(users.URL)
+	ordersURL, _ := url.Parse(orders.URL)
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			if strings.HasPrefix(r.In.URL.Path, "/orders") {
+				r.SetURL(ordersURL)
+				return
+			}
+			r.SetURL(usersURL)
+		},
+	}
+	InstrumentReverseProxy(proxy, WithUpstreamFunc(func(r *http.Request) string {
+		if r.URL.Host == ordersURL.Host {
+			return ordersName
+		}
+		return usersName
+	}))
+	// instrumenting twice must not count twice
+	InstrumentReverseProxy(proxy, WithUpstreamName("test-twice"))
+
+	front := httptest.NewServer(proxy)
+	defer front.Close()
+
+	for _, path := range []string{"/users/1", "/users/2", "/orders/1"} {
+		resp, err := http.Get(front.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if got := testutil.ToFloat64(ProxyRequestsTotal.WithLabelValues(usersName, "get", "200")); got != 2 {
+		t.Errorf("users requests = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(ProxyRequestsTotal.WithLabelValues(ordersName, "get", "404")); got != 1 {
+		t.Errorf("orders requests = %v, want 1", got)
+	}
+}
+
+func TestInstrumentReverseProxyErrors(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL, _ := url.Parse(down.URL)
+	down.Close()
+
+	name := uniqueTestName("test-down")
+	proxy := InstrumentReverseProxy(httputil.NewSingleHostReverseProxy(downURL), WithUpstreamName(name))
+	proxy.ErrorLog = nil
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	if got := testutil.ToFloat64(ProxyErrorsTotal.WithLabelValues(name, "dial")); got != 1 {
+		t.Errorf("dial errors = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(ProxyRequestsTotal.WithLabelValues(name, "get", "error")); got != 1 {
+		t.Errorf("failed requests = %v, want 1", got)
+	}
+}
+
+func TestProxyErrorType(t *testing.T) {
+	tests := map[string]error{
+		"canceled":        context.Canceled,
+		"timeout":         context.DeadlineExceeded,
+		"modify_response": &modifyResponseError{err: errors.New("boom")},
+		"other":           errors.New("boom"),
+	}
+	for want, err := range tests {
+		if got := proxyErrorType(err); got != want {
+			t.Errorf("proxyErrorType(%v) = %q, want %q", err, got, want)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	if got := proxyErrorType(ctx.Err()); got != "timeout" {
+		t.Errorf("proxyErrorType(deadline) = %q, want timeout", got)
+	}
+}
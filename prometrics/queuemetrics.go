@@ -0,0 +1,366 @@
+package prometrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// QueueEnqueuedTotal counts the jobs added to a queue, labeled by queue name.
+	//
+	// Metric type: CounterVec
+	QueueEnqueuedTotal = CreateCounter("queue_enqueued_total", "Total jobs enqueued", []string{"queue"})
+	// QueueDequeuedTotal counts the jobs taken from a queue by a worker, labeled by queue name.
+	//
+	// Metric type: CounterVec
+	QueueDequeuedTotal = CreateCounter("queue_dequeued_total", "Total jobs dequeued", []string{"queue"})
+	// QueueRetriesTotal counts the job attempts that failed and were retried, labeled by queue name.
+	//
+	// Metric type: CounterVec
+	QueueRetriesTotal = CreateCounter("queue_retries_total", "Total job retries", []string{"queue"})
+	// QueueDeadLetteredTotal counts the jobs given up after their last attempt failed,
+	// labeled by queue name.
+	//
+	// Metric type: CounterVec
+	QueueDeadLetteredTotal = CreateCounter("queue_dead_lettered_total", "Total jobs dead-lettered", []string{"queue"})
+	// QueueProcessedTotal counts the job attempts, labeled by queue name and outcome (success, error).
+	//
+	// Metric type: CounterVec
+	QueueProcessedTotal = CreateCounter("queue_processed_total", "Total job attempts by outcome", []string{"queue", "outcome"})
+	// QueueDepth reports the number of jobs waiting in a queue, labeled by queue name.
+	//
+	// Metric type: GaugeVec
+	QueueDepth = CreateGauge("queue_depth", "Current number of jobs waiting in the queue", []string{"queue"})
+	// QueueConcurrency reports the number of jobs being processed, labeled by queue name.
+	//
+	// Metric type: GaugeVec
+	QueueConcurrency = CreateGauge("queue_concurrency_in_use", "Current number of jobs being processed", []string{"queue"})
+	// QueueWaitDuration tracks the time jobs wait between being enqueued and their
+	// processing start in seconds, labeled by queue name.
+	//
+	// Metric type: HistogramVec
+	QueueWaitDuration = CreateHistogram("queue_wait_duration_seconds", "Time jobs waited in the queue in seconds", []string{"queue"}, nil)
+	// QueueProcessingDuration tracks the duration of job attempts in seconds, labeled by queue name.
+	//
+	// Metric type: HistogramVec
+	QueueProcessingDuration = CreateHistogram("queue_processing_duration_seconds", "Duration of job attempts in seconds", []string{"queue"}, nil)
+)
+
+// QueueMetrics records the standard metrics of one job queue.
+type QueueMetrics struct {
+	name         string
+	enqueued     prometheus.Counter
+	dequeued     prometheus.Counter
+	retries      prometheus.Counter
+	deadLettered prometheus.Counter
+	depth        prometheus.Gauge
+	concurrency  prometheus.Gauge
+	wait         prometheus.Observer
+	processing   prometheus.Observer
+}
+
+// NewQueueMetrics returns the QueueMetrics of the queue called name.
+//
+// Example, for a queue backed by an external broker:
+//
+//	metrics := prometrics.NewQueueMetrics("emails")
+//	metrics.Dequeued(msg.EnqueuedAt)
+//	done := metrics.TrackProcessing()
+//	err := send(msg)
+//	done(err)
+func NewQueueMetrics(name string) *QueueMetrics {
+	return &QueueMetrics{
+		name:         name,
+		enqueued:     QueueEnqueuedTotal.WithLabelValues(name),
+		dequeued:     QueueDequeuedTotal.WithLabelValues(name),
+		retries:      QueueRetriesTotal.WithLabelValues(name),
+		deadLettered: QueueDeadLetteredTotal.WithLabelValues(name),
+		depth:        QueueDepth.WithLabelValues(name),
+		concurrency:  QueueConcurrency.WithLabelValues(name),
+		wait:         QueueWaitDuration.WithLabelValues(name),
+		processing:   QueueProcessingDuration.WithLabelValues(name),
+	}
+}
+
+// Enqueued counts a job added to the queue and increments its depth.
+func (m *QueueMetrics) Enqueued() {
+	m.enqueued.Inc()
+	m.depth.Inc()
+}
+
+// Dequeued counts a job taken from the queue, decrements its depth and observes how long
+// it waited since enqueuedAt. A zero enqueuedAt skips the wait time.
+func (m *QueueMetrics) Dequeued(enqueuedAt time.Time) {
+	m.dequeued.Inc()
+	m.depth.Dec()
+	if !enqueuedAt.IsZero() {
+		m.wait.Observe(time.Since(enqueuedAt).Seconds())
+	}
+}
+
+// SetDepth sets the queue depth, for queues whose depth is read from a broker rather than
+// tracked with Enqueued and Dequeued.
+func (m *QueueMetrics) SetDepth(n int) { m.depth.Set(float64(n)) }
+
+// Retried counts a failed job attempt that will be retried.
+func (m *QueueMetrics) Retried() { m.retries.Inc() }
+
+// DeadLettered counts a job given up after its last attempt failed.
+func (m *QueueMetrics) DeadLettered() { m.deadLettered.Inc() }
+
+// TrackProcessing records a job attempt. It should be called when the attempt starts, the
+// returned function is called with the error of the attempt and observes its duration.
+func (m *QueueMetrics) TrackProcessing() func(err error) {
+	start := time.Now()
+	m.concurrency.Inc()
+	return func(err error) {
+		m.concurrency.Dec()
+		m.processing.Observe(time.Since(start).Seconds())
+		outcome := OutcomeSuccess
+		if err != nil {
+			outcome = OutcomeError
+		}
+		QueueProcessedTotal.WithLabelValues(m.name, outcome).Inc()
+	}
+}
+
+// ErrWorkerPoolClosed is returned when submitting a job to a closed WorkerPool.
+var ErrWorkerPoolClosed = errors.New("prometrics: worker pool closed")
+
+// WorkerPoolOption configures a WorkerPool.
+type WorkerPoolOption func(*workerPoolConfig)
+
+type workerPoolConfig struct {
+	workers    int
+	queueSize  int
+	maxRetries int
+	backoff    time.Duration
+}
+
+// WithWorkers sets the number of jobs processed concurrently. The default is 1.
+func WithWorkers(n int) WorkerPoolOption {
+	return func(c *workerPoolConfig) {
+		c.workers = n
+	}
+}
+
+// WithQueueSize sets how many jobs can wait in the queue before Submit blocks. The default is 100.
+func WithQueueSize(n int) WorkerPoolOption {
+	return func(c *workerPoolConfig) {
+		c.queueSize = n
+	}
+}
+
+// WithMaxRetries sets how many times a failed job is retried before it is dead-lettered.
+// The default is 0, failed jobs are dead-lettered right away.
+func WithMaxRetries(n int) WorkerPoolOption {
+	return func(c *workerPoolConfig) {
+		c.maxRetries = n
+	}
+}
+
+// WithRetryBackoff sets the delay before the first retry of a job, doubled for every
+// further retry. The default is 100 milliseconds.
+func WithRetryBackoff(d time.Duration) WorkerPoolOption {
+	return func(c *workerPoolConfig) {
+		c.backoff = d
+	}
+}
+
+type poolJob[T any] struct {
+	job        T
+	enqueuedAt time.Time
+}
+
+// WorkerPool processes jobs of type T with a fixed number of workers and records the
+// QueueMetrics of its queue: enqueued and dequeued jobs, depth, wait and processing
+// time, concurrency in use, retries and dead letters. A panic in the handler is recovered
+// and treated as a failed attempt.
+type WorkerPool[T any] struct {
+	cfg        workerPoolConfig
+	handler    func(ctx context.Context, job T) error
+	deadLetter func(job T, err error)
+	metrics    *QueueMetrics
+
+	jobs      chan poolJob[T]
+	mu        sync.RWMutex
+	started   bool
+	closed    bool
+	done      chan struct{}
+	submits   sync.WaitGroup
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewWorkerPool creates a WorkerPool for the queue called name, processing jobs with
+// handler. Jobs can be submitted right away, they are processed once Start is called.
+//
+// Example:
+//
+//	pool := prometrics.NewWorkerPool("emails", sendEmail, prometrics.WithWorkers(4), prometrics.WithMaxRetries(3))
+//	pool.OnDeadLetter(func(e Email, err error) { log.Printf("giving up on %s: %v", e.To, err) })
+//	pool.Start(ctx)
+//	defer pool.Close()
+//	pool.Submit(ctx, email)
+func NewWorkerPool[T any](name string, handler func(ctx context.Context, job T) error, opts ...WorkerPoolOption) *WorkerPool[T] {
+	cfg := workerPoolConfig{workers: 1, queueSize: 100, backoff: 100 * time.Millisecond}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &WorkerPool[T]{
+		cfg:     cfg,
+		handler: handler,
+		metrics: NewQueueMetrics(name),
+		jobs:    make(chan poolJob[T], cfg.queueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+// OnDeadLetter sets the function called with the jobs whose last attempt failed.
+func (p *WorkerPool[T]) OnDeadLetter(fn func(job T, err error)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deadLetter = fn
+}
+
+// Metrics returns the QueueMetrics of the pool.
+func (p *WorkerPool[T]) Metrics() *QueueMetrics { return p.metrics }
+
+// Start starts the workers. They stop when ctx is cancelled, or once the queue is drained
+// after Close. Cancelling ctx also closes the pool, the jobs still queued then are dropped.
+func (p *WorkerPool[T]) Start(ctx context.Context) {
+	p.startOnce.Do(func() {
+		p.mu.Lock()
+		p.started = true
+		p.mu.Unlock()
+		for i := 0; i < p.cfg.workers; i++ {
+			p.wg.Add(1)
+			go func() {
+				defer p.wg.Done()
+				p.work(ctx)
+			}()
+		}
+		go func() {
+			select {
+			case <-ctx.Done():
+				p.Close()
+			case <-p.done:
+			}
+		}()
+	})
+}
+
+// Submit adds a job to the queue, waiting for room if the queue is full. It returns
+// ErrWorkerPoolClosed if the pool is closed before the job is queued.
+func (p *WorkerPool[T]) Submit(ctx context.Context, job T) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrWorkerPoolClosed
+	}
+	p.submits.Add(1)
+	p.mu.RUnlock()
+	defer p.submits.Done()
+
+	// the depth is raised first, a worker may take the job before the send returns
+	p.metrics.depth.Inc()
+	select {
+	case p.jobs <- poolJob[T]{job: job, enqueuedAt: time.Now()}:
+		p.metrics.enqueued.Inc()
+		return nil
+	case <-ctx.Done():
+		p.metrics.depth.Dec()
+		return ctx.Err()
+	case <-p.done:
+		p.metrics.depth.Dec()
+		return ErrWorkerPoolClosed
+	}
+}
+
+// Close stops accepting jobs and waits until the queued jobs are processed, or dropped if
+// the workers were stopped by the cancellation of their context. It panics if Start was
+// not called, as the queued jobs would never be processed.
+func (p *WorkerPool[T]) Close() {
+	p.mu.RLock()
+	started := p.started
+	p.mu.RUnlock()
+	if !started {
+		panic("prometrics: WorkerPool closed before Start")
+	}
+	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.closed = true
+		p.mu.Unlock()
+		close(p.done)
+		// no job can be sent once the pending Submit calls returned
+		p.submits.Wait()
+		close(p.jobs)
+	})
+	p.wg.Wait()
+	for range p.jobs {
+		p.metrics.depth.Dec()
+	}
+}
+
+func (p *WorkerPool[T]) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			p.metrics.Dequeued(j.enqueuedAt)
+			p.process(ctx, j.job)
+		}
+	}
+}
+
+// process runs the handler for job, retrying it with backoff until it succeeds or the
+// retries are exhausted.
+func (p *WorkerPool[T]) process(ctx context.Context, job T) {
+	backoff := p.cfg.backoff
+	for attempt := 0; ; attempt++ {
+		done := p.metrics.TrackProcessing()
+		err := p.call(ctx, job)
+		done(err)
+		if err == nil {
+			return
+		}
+		if attempt >= p.cfg.maxRetries || ctx.Err() != nil {
+			p.metrics.DeadLettered()
+			p.mu.RLock()
+			deadLetter := p.deadLetter
+			p.mu.RUnlock()
+			if deadLetter != nil {
+				deadLetter(job, err)
+			}
+			return
+		}
+
+		p.metrics.Retried()
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+		backoff *= 2
+	}
+}
+
+func (p *WorkerPool[T]) call(ctx context.Context, job T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return p.handler(ctx, job)
+}
@@ -0,0 +1,165 @@
+package prometrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWorkerPool(t *testing.T) {
+	attempts := make(map[int]int)
+	var mu sync.Mutex
+	name := uniqueTestName("test-queue")
+	pool := NewWorkerPool(name, func(ctx context.Context, job int) error {
+		mu.Lock()
+		attempts[job]++
+		n := attempts[job]
+		mu.Unlock()
+		switch {
+		case job == 2 && n == 1:
+			return errors.New("temporary failure")
+		case job == 3:
+			panic("bad job")
+		}
+		return nil
+	}, WithWorkers(2), WithMaxRetries(1), WithRetryBackoff(time.Millisecond))
+
+	var dead []int
+	pool.OnDeadLetter(func(job int, err error) {
+		mu.Lock()
+		dead = append(dead, job)
+		mu.Unlock()
+	})
+
+	for job := 1; job <= 3; job++ {
+		if err := pool.Submit(context.Background(), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool.Start(context.Background())
+	pool.Close()
+
+	if err := pool.Submit(context.Background(), 4); !errors.Is(err, ErrWorkerPoolClosed) {
+		t.Errorf("Submit after Close = %v, want ErrWorkerPoolClosed", err)
+	}
+	if len(dead) != 1 || dead[0] != 3 {
+		t.Errorf("dead letters = %v, want [3]", dead)
+	}
+
+	if got := testutil.ToFloat64(QueueEnqueuedTotal.WithLabelValues(name)); got != 3 {
+		t.Errorf("enqueued = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(QueueDequeuedTotal.WithLabelValues(name)); got != 3 {
+		t.Errorf("dequeued = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(QueueDepth.WithLabelValues(name)); got != 0 {
+		t.Errorf("depth = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(QueueConcurrency.WithLabelValues(name)); got != 0 {
+		t.Errorf("concurrency = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(QueueRetriesTotal.WithLabelValues(name)); got != 2 {
+		t.Errorf("retries = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(QueueDeadLetteredTotal.WithLabelValues(name)); got != 1 {
+		t.Errorf("dead lettered = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(QueueProcessedTotal.WithLabelValues(name, OutcomeSuccess)); got != 2 {
+		t.Errorf("successes = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(QueueProcessedTotal.WithLabelValues(name, OutcomeError)); got != 3 {
+		t.Errorf("errors = %v, want 3", got)
+	}
+}
+
+func TestWorkerPoolCancel(t *testing.T) {
+	name := uniqueTestName("test-queue")
+	started := make(chan struct{}, 1)
+	pool := NewWorkerPool(name, func(ctx context.Context, job int) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithQueueSize(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.Start(ctx)
+	if err := pool.Submit(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := pool.Submit(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// the queue is full, the third job waits until the workers are stopped, unless one
+	// takes the second job before seeing the cancellation
+	blocked := make(chan error)
+	go func() { blocked <- pool.Submit(context.Background(), 3) }()
+	cancel()
+	select {
+	case err := <-blocked:
+		if err != nil && !errors.Is(err, ErrWorkerPoolClosed) {
+			t.Errorf("Submit on a full queue after cancel = %v, want ErrWorkerPoolClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Submit on a full queue did not return after cancel")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return after cancel")
+	}
+
+	if got := testutil.ToFloat64(QueueDepth.WithLabelValues(name)); got != 0 {
+		t.Errorf("depth = %v, want 0 once the dropped jobs are removed", got)
+	}
+	if err := pool.Submit(context.Background(), 4); !errors.Is(err, ErrWorkerPoolClosed) {
+		t.Errorf("Submit after cancel = %v, want ErrWorkerPoolClosed", err)
+	}
+}
+
+func TestWorkerPoolOnDeadLetterAfterStart(t *testing.T) {
+	pool := NewWorkerPool(uniqueTestName("test-queue"), func(ctx context.Context, job int) error {
+		return errors.New("failure")
+	})
+	pool.Start(context.Background())
+	if err := pool.Submit(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	// must not race with the worker dead-lettering the first job
+	dead := make(chan int, 2)
+	pool.OnDeadLetter(func(job int, err error) { dead <- job })
+	if err := pool.Submit(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	pool.Close()
+	if job := <-dead; job != 2 && job != 1 {
+		t.Errorf("dead letter = %d, want a submitted job", job)
+	}
+}
+
+func TestWorkerPoolCloseBeforeStart(t *testing.T) {
+	pool := NewWorkerPool(uniqueTestName("test-queue"), func(ctx context.Context, job int) error { return nil })
+	if err := pool.Submit(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Close before Start should panic instead of dropping the queued jobs")
+		}
+	}()
+	pool.Close()
+}
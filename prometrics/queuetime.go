@@ -0,0 +1,73 @@
+package prometrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseRequestStart parses the value of a X-Request-Start/X-Queue-Start header.
+//
+// The following formats are understood:
+//   - t=1700000000123456 (microseconds, as set by eg. New Relic style configs)
+//   - t=1700000000.123 (seconds with fraction, eg. nginx ${msec})
+//   - 1700000000123 (raw milliseconds, eg. Heroku router)
+//
+// Integer values are interpreted by magnitude, so seconds, milliseconds,
+// microseconds and nanoseconds are all accepted with or without the "t=" prefix.
+func parseRequestStart(v string) (time.Time, bool) {
+	v = strings.TrimSpace(v)
+	// some proxies append further fields, eg. "t=1700000000.123 D=42"
+	if i := strings.IndexAny(v, " ,;"); i >= 0 {
+		v = v[:i]
+	}
+	v = strings.TrimPrefix(v, "t=")
+	if v == "" {
+		return time.Time{}, false
+	}
+
+	if strings.Contains(v, ".") {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return time.Time{}, false
+		}
+		sec := int64(f)
+		return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, false
+	}
+	switch {
+	case n >= 1e17:
+		return time.Unix(0, n), true
+	case n >= 1e14:
+		return time.UnixMicro(n), true
+	case n >= 1e11:
+		return time.UnixMilli(n), true
+	default:
+		return time.Unix(n, 0), true
+	}
+}
+
+// queueDuration returns the time elapsed between the header value v and now.
+// Small negative values up to skew are clamped to zero, values further in the
+// future or older than max are rejected.
+func queueDuration(v string, now time.Time, skew, max time.Duration) (time.Duration, bool) {
+	start, ok := parseRequestStart(v)
+	if !ok {
+		return 0, false
+	}
+	d := now.Sub(start)
+	if d < 0 {
+		if -d > skew {
+			return 0, false
+		}
+		d = 0
+	}
+	if max > 0 && d > max {
+		return 0, false
+	}
+	return d, true
+}
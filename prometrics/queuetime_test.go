@@ -0,0 +1,58 @@
+package prometrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRequestStart(t *testing.T) {
+	want := time.UnixMilli(1700000000123)
+
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"micros", "t=1700000000123000", true},
+		{"seconds with fraction", "t=1700000000.123", true},
+		{"raw millis", "1700000000123", true},
+		{"nanos", "1700000000123000000", true},
+		{"extra fields", "t=1700000000123000 D=42", true},
+		{"empty", "t=", false},
+		{"garbage", "t=abc", false},
+		{"negative", "-1700000000123", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRequestStart(tt.value)
+			if ok != tt.ok {
+				t.Fatalf("parseRequestStart(%q) ok = %v, want %v", tt.value, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if d := got.Sub(want); d < -time.Millisecond || d > time.Millisecond {
+				t.Errorf("parseRequestStart(%q) = %v, want %v", tt.value, got, want)
+			}
+		})
+	}
+}
+
+func TestQueueDurationGuards(t *testing.T) {
+	now := time.UnixMilli(1700000010000)
+
+	if d, ok := queueDuration("1700000009750", now, time.Second, time.Minute); !ok || d != 250*time.Millisecond {
+		t.Errorf("queueDuration = %v, %v, want 250ms, true", d, ok)
+	}
+	// clock of the proxy slightly ahead of ours
+	if d, ok := queueDuration("1700000010500", now, time.Second, time.Minute); !ok || d != 0 {
+		t.Errorf("queueDuration with small skew = %v, %v, want 0, true", d, ok)
+	}
+	if _, ok := queueDuration("1700000015000", now, time.Second, time.Minute); ok {
+		t.Error("queueDuration accepted a start time far in the future")
+	}
+	if _, ok := queueDuration("1699999000000", now, time.Second, time.Minute); ok {
+		t.Error("queueDuration accepted a start time older than max")
+	}
+}
@@ -0,0 +1,305 @@
+package prometrics
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpObservation is one finished request as seen by a middleware front-end
+// (net/http or gin), before it is turned into metrics by recordRequest.
+type httpObservation struct {
+	request  *http.Request
+	path     string
+	method   string
+	code     string
+	elapsed  time.Duration
+	reqSize  int64 // negative when unknown
+	respSize int64
+	stream   *Stream
+	weight   float64 // counters are scaled by weight for sampled routes
+}
+
+// recordRequest is the single place where requests are recorded into the HTTP metrics,
+// so every front-end produces the same series for the same request. The label transforms
+// are applied to o, so views derived from it afterwards use the same labels.
+func (c *httpConfig) recordRequest(o *httpObservation) {
+	o.method = sanitizeMethod(o.method)
+	c.transformLabels(o)
+	streaming := o.stream.end(o.respSize)
+
+	HttpRequestsTotal.WithLabelValues(o.path, o.method, o.code).Add(o.weight)
+	if !streaming || c.streamDurations {
+		HttpRequestDuration.WithLabelValues(o.path, o.method, o.code).Observe(o.elapsed.Seconds())
+	}
+	if o.reqSize >= 0 {
+		HttpRequestSize.WithLabelValues(o.path, o.method, o.code).Observe(float64(o.reqSize))
+	}
+	HttpResponseSize.WithLabelValues(o.path, o.method, o.code).Observe(float64(o.respSize))
+}
+
+// MethodOther is the method label of the requests whose method is not a standard HTTP
+// method, eg. sent by scanners, so junk traffic cannot create arbitrary label values.
+const MethodOther = "OTHER"
+
+// sanitizeMethod returns the method label of a request, before the label transforms run.
+// Standard methods are lower case, like the values produced by promhttp which earlier
+// versions of InstrumentHttpHandler used, and every other method is MethodOther, so every
+// front-end records the same method for the same request.
+func sanitizeMethod(m string) string {
+	switch strings.ToUpper(m) {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return strings.ToLower(m)
+	default:
+		return MethodOther
+	}
+}
+
+// approximateRequestSize estimates the size of r the same way promhttp does.
+func approximateRequestSize(r *http.Request) int64 {
+	var s int64
+	if r.URL != nil {
+		s += int64(len(r.URL.String()))
+	}
+	s += int64(len(r.Method) + len(r.Proto) + len(r.Host))
+	for name, values := range r.Header {
+		s += int64(len(name))
+		for _, value := range values {
+			s += int64(len(value))
+		}
+	}
+	if r.ContentLength != -1 {
+		s += r.ContentLength
+	}
+	return s
+}
+
+// responseWriter captures the status code and body size of a response and detects
+// streaming responses. Handlers get it through delegator, which only advertises the
+// optional interfaces (Flusher, Hijacker, ReaderFrom, Pusher) of the wrapped writer,
+// like promhttp does, and Unwrap makes it work with http.ResponseController.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	written     int64
+	wroteHeader bool
+	stream      *Stream
+}
+
+func newResponseWriter(w http.ResponseWriter, stream *Stream) *responseWriter {
+	return &responseWriter{ResponseWriter: w, stream: stream}
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	// informational responses other than 101 may be followed by the real one
+	if !w.wroteHeader && (code >= 200 || code == http.StatusSwitchingProtocols) {
+		w.status = code
+		w.wroteHeader = true
+		w.stream.detectResponse(w.Header())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+type flusherDelegator struct{ *responseWriter }
+
+func (w flusherDelegator) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+type hijackerDelegator struct{ *responseWriter }
+
+func (w hijackerDelegator) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err != nil {
+		return conn, rw, err
+	}
+	if !w.wroteHeader {
+		w.status = http.StatusSwitchingProtocols
+		w.wroteHeader = true
+	}
+	conn, rw = w.stream.hijacked(conn, rw)
+	return conn, rw, nil
+}
+
+type readerFromDelegator struct{ *responseWriter }
+
+func (w readerFromDelegator) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	w.written += n
+	return n, err
+}
+
+type pusherDelegator struct{ *responseWriter }
+
+func (w pusherDelegator) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+const (
+	delegateFlusher = 1 << iota
+	delegateHijacker
+	delegateReaderFrom
+	delegatePusher
+)
+
+// delegator returns w as an http.ResponseWriter implementing the same optional
+// interfaces as the writer it wraps, so type assertions in handlers keep their meaning.
+func (w *responseWriter) delegator() http.ResponseWriter {
+	id := 0
+	if _, ok := w.ResponseWriter.(http.Flusher); ok {
+		id |= delegateFlusher
+	}
+	if _, ok := w.ResponseWriter.(http.Hijacker); ok {
+		id |= delegateHijacker
+	}
+	if _, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		id |= delegateReaderFrom
+	}
+	if _, ok := w.ResponseWriter.(http.Pusher); ok {
+		id |= delegatePusher
+	}
+	return pickDelegator[id](w)
+}
+
+var pickDelegator = [16]func(*responseWriter) http.ResponseWriter{
+	func(w *responseWriter) http.ResponseWriter { return w },
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Flusher
+		}{w, flusherDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Hijacker
+		}{w, hijackerDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+		}{w, flusherDelegator{w}, hijackerDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			io.ReaderFrom
+		}{w, readerFromDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Flusher
+			io.ReaderFrom
+		}{w, flusherDelegator{w}, readerFromDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{w, hijackerDelegator{w}, readerFromDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{w, flusherDelegator{w}, hijackerDelegator{w}, readerFromDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Pusher
+		}{w, pusherDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Pusher
+		}{w, flusherDelegator{w}, pusherDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Hijacker
+			http.Pusher
+		}{w, hijackerDelegator{w}, pusherDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, flusherDelegator{w}, hijackerDelegator{w}, pusherDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			io.ReaderFrom
+			http.Pusher
+		}{w, readerFromDelegator{w}, pusherDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+		}{w, flusherDelegator{w}, readerFromDelegator{w}, pusherDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{w, hijackerDelegator{w}, readerFromDelegator{w}, pusherDelegator{w}}
+	},
+	func(w *responseWriter) http.ResponseWriter {
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{w, flusherDelegator{w}, hijackerDelegator{w}, readerFromDelegator{w}, pusherDelegator{w}}
+	},
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// code returns the status code label, defaulting to 200 like net/http does.
+func (w *responseWriter) code() string {
+	if w.status == 0 {
+		return "200"
+	}
+	return strconv.Itoa(w.status)
+}
@@ -0,0 +1,188 @@
+package prometrics
+
+import (
+	"math"
+	"regexp"
+	"runtime/metrics"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RuntimeMetricsOption configures the RuntimeMetricsCollector.
+type RuntimeMetricsOption func(*runtimeMetricsConfig)
+
+type runtimeMetricsConfig struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// WithRuntimeMetricsAllow only exports the runtime/metrics whose name (eg. "/gc/pauses:seconds")
+// matches one of res.
+func WithRuntimeMetricsAllow(res ...*regexp.Regexp) RuntimeMetricsOption {
+	return func(c *runtimeMetricsConfig) {
+		c.allow = append(c.allow, res...)
+	}
+}
+
+// WithRuntimeMetricsDeny leaves out the runtime/metrics whose name matches one of res.
+// Deny rules take precedence over allow rules. By default "/godebug/" metrics are denied.
+func WithRuntimeMetricsDeny(res ...*regexp.Regexp) RuntimeMetricsOption {
+	return func(c *runtimeMetricsConfig) {
+		c.deny = append(c.deny, res...)
+	}
+}
+
+func (c *runtimeMetricsConfig) exported(name string) bool {
+	for _, re := range c.deny {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	if len(c.allow) == 0 {
+		return true
+	}
+	for _, re := range c.allow {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RuntimeMetricsCollector is a prometheus.Collector exporting the metrics of the Go
+// runtime/metrics package: GC pause and scheduler latency histograms, heap object and
+// size classes, mutex wait time, GOGC and GOMEMLIMIT settings and more.
+//
+// Every runtime metric is mapped to a Prometheus metric prefixed with "app_runtime_":
+// the path separators and the unit become underscores, so "/gc/pauses:seconds" is
+// exported as app_runtime_gc_pauses_seconds. Cumulative metrics are counters with a
+// "_total" suffix, distributions are histograms and everything else is a gauge.
+// The prefix keeps the metrics apart from the go_* metrics of the default Go collector.
+//
+// Reading runtime/metrics does not stop the world.
+type RuntimeMetricsCollector struct {
+	descs   []*prometheus.Desc
+	kinds   []metrics.ValueKind
+	counter []bool
+
+	mu      sync.Mutex
+	samples []metrics.Sample
+}
+
+// NewRuntimeMetricsCollector creates a RuntimeMetricsCollector for the runtime metrics
+// supported by the running Go version, filtered by the given options.
+func NewRuntimeMetricsCollector(opts ...RuntimeMetricsOption) *RuntimeMetricsCollector {
+	cfg := &runtimeMetricsConfig{deny: []*regexp.Regexp{regexp.MustCompile(`^/godebug/`)}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	c := &RuntimeMetricsCollector{}
+	for _, d := range metrics.All() {
+		if d.Kind == metrics.KindBad || !cfg.exported(d.Name) {
+			continue
+		}
+		name := runtimeMetricName(d.Name)
+		if d.Cumulative && d.Kind != metrics.KindFloat64Histogram {
+			name += "_total"
+		}
+		c.descs = append(c.descs, prometheus.NewDesc(name, d.Description, nil, nil))
+		c.kinds = append(c.kinds, d.Kind)
+		c.counter = append(c.counter, d.Cumulative)
+		c.samples = append(c.samples, metrics.Sample{Name: d.Name})
+	}
+	return c
+}
+
+// RegisterRuntimeMetricsCollector creates a RuntimeMetricsCollector and registers it with
+// reg, or with prometheus.DefaultRegisterer if reg is nil.
+//
+// Example, exporting only GC and scheduler metrics:
+//
+//	prometrics.RegisterRuntimeMetricsCollector(nil,
+//	    prometrics.WithRuntimeMetricsAllow(regexp.MustCompile(`^/(gc|sched)/`)))
+func RegisterRuntimeMetricsCollector(reg prometheus.Registerer, opts ...RuntimeMetricsOption) error {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	return reg.Register(NewRuntimeMetricsCollector(opts...))
+}
+
+// Describe implements prometheus.Collector.
+func (c *RuntimeMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.descs {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *RuntimeMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics.Read(c.samples)
+	for i, s := range c.samples {
+		valueType := prometheus.GaugeValue
+		if c.counter[i] {
+			valueType = prometheus.CounterValue
+		}
+		switch c.kinds[i] {
+		case metrics.KindUint64:
+			ch <- prometheus.MustNewConstMetric(c.descs[i], valueType, float64(s.Value.Uint64()))
+		case metrics.KindFloat64:
+			ch <- prometheus.MustNewConstMetric(c.descs[i], valueType, s.Value.Float64())
+		case metrics.KindFloat64Histogram:
+			count, sum, buckets := runtimeHistogram(s.Value.Float64Histogram())
+			ch <- prometheus.MustNewConstHistogram(c.descs[i], count, sum, buckets)
+		}
+	}
+}
+
+var runtimeMetricNameReplacer = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// runtimeMetricName maps a runtime/metrics name such as "/gc/heap/allocs-by-size:bytes"
+// to app_runtime_gc_heap_allocs_by_size_bytes.
+func runtimeMetricName(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	name = runtimeMetricNameReplacer.ReplaceAllString(name, "_")
+	return "app_runtime_" + strings.Trim(name, "_")
+}
+
+// runtimeHistogram converts a runtime histogram into the cumulative buckets of a
+// Prometheus histogram. The fine grained runtime buckets are merged so that upper bounds
+// grow at least by a factor of 2, which keeps the number of series reasonable.
+// runtime/metrics does not track the sum of the observations, it is estimated from the
+// bucket midpoints.
+func runtimeHistogram(h *metrics.Float64Histogram) (uint64, float64, map[float64]uint64) {
+	buckets := make(map[float64]uint64)
+	var count uint64
+	var sum float64
+	last := math.Inf(-1)
+
+	for i, n := range h.Counts {
+		lower, upper := h.Buckets[i], h.Buckets[i+1]
+		count += n
+
+		if n > 0 {
+			mid := (lower + upper) / 2
+			switch {
+			case math.IsInf(lower, -1):
+				mid = upper
+			case math.IsInf(upper, 1):
+				mid = lower
+			}
+			sum += mid * float64(n)
+		}
+
+		if math.IsInf(upper, 1) {
+			continue
+		}
+		if upper <= 0 || last <= 0 || upper >= last*2 || i == len(h.Counts)-1 {
+			buckets[upper] = count
+			last = upper
+		}
+	}
+	return count, sum, buckets
+}
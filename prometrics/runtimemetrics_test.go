@@ -0,0 +1,67 @@
+package prometrics
+
+import (
+	"math"
+	"regexp"
+	"runtime/metrics"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRuntimeMetricName(t *testing.T) {
+	tests := map[string]string{
+		"/gc/pauses:seconds":                      "app_runtime_gc_pauses_seconds",
+		"/gc/heap/allocs-by-size:bytes":           "app_runtime_gc_heap_allocs_by_size_bytes",
+		"/cpu/classes/gc/mark/assist:cpu-seconds": "app_runtime_cpu_classes_gc_mark_assist_cpu_seconds",
+	}
+	for in, want := range tests {
+		if got := runtimeMetricName(in); got != want {
+			t.Errorf("runtimeMetricName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRuntimeHistogram(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{1, 2, 3, 4, 5},
+		Buckets: []float64{math.Inf(-1), 1, 1.5, 2, 4, math.Inf(1)},
+	}
+	count, _, buckets := runtimeHistogram(h)
+	if count != 15 {
+		t.Errorf("count = %d, want 15", count)
+	}
+	// 1.5 is merged into 2, as it is less than twice the previous bound
+	want := map[float64]uint64{1: 1, 2: 6, 4: 10}
+	if len(buckets) != len(want) {
+		t.Fatalf("buckets = %v, want %v", buckets, want)
+	}
+	for le, n := range want {
+		if buckets[le] != n {
+			t.Errorf("bucket %v = %d, want %d", le, buckets[le], n)
+		}
+	}
+}
+
+func TestRuntimeMetricsCollector(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	err := RegisterRuntimeMetricsCollector(reg,
+		WithRuntimeMetricsAllow(regexp.MustCompile(`^/(gc|sched)/`)),
+		WithRuntimeMetricsDeny(regexp.MustCompile(`^/gc/heap/`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]int{
+		"app_runtime_gc_gogc_percent":                 1,
+		"app_runtime_sched_latencies_seconds":         1,
+		"app_runtime_gc_cycles_total_gc_cycles_total": 1,
+		"app_runtime_gc_heap_objects_objects":         0,
+		"app_runtime_memory_classes_total_bytes":      0,
+	} {
+		if n, err := testutil.GatherAndCount(reg, name); err != nil || n != want {
+			t.Errorf("%s series = %d, %v, want %d", name, n, err, want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package prometrics
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// pathRule matches a request by exact path, path prefix or regular expression.
+type pathRule struct {
+	exact  string
+	prefix string
+	re     *regexp.Regexp
+}
+
+func (p pathRule) match(path string) bool {
+	switch {
+	case p.re != nil:
+		return p.re.MatchString(path)
+	case p.prefix != "":
+		return strings.HasPrefix(path, p.prefix)
+	default:
+		return p.exact == path
+	}
+}
+
+type sampleRule struct {
+	route string
+	rate  float64
+}
+
+// WithSkipPaths excludes requests whose path is exactly one of paths from all HTTP metrics.
+//
+// Example:
+//
+//	r.Use(prometrics.NewHttpMiddleware(prometrics.WithSkipPaths("/metrics", "/healthz", "/readyz")))
+func WithSkipPaths(paths ...string) HttpOption {
+	return func(c *httpConfig) {
+		for _, p := range paths {
+			c.skip = append(c.skip, pathRule{exact: p})
+		}
+	}
+}
+
+// WithSkipPathPrefixes excludes requests whose path starts with one of prefixes from all HTTP metrics.
+func WithSkipPathPrefixes(prefixes ...string) HttpOption {
+	return func(c *httpConfig) {
+		for _, p := range prefixes {
+			c.skip = append(c.skip, pathRule{prefix: p})
+		}
+	}
+}
+
+// WithSkipPathRegexp excludes requests whose path matches re from all HTTP metrics.
+func WithSkipPathRegexp(re *regexp.Regexp) HttpOption {
+	return func(c *httpConfig) {
+		c.skip = append(c.skip, pathRule{re: re})
+	}
+}
+
+// WithSampling instruments only a fraction rate (0 < rate <= 1) of the requests of a route,
+// to reduce the overhead on very hot endpoints. The route is matched against the path label
+// (eg. the gin route "/person/:id") or the request path.
+//
+// Counters and the in-flight gauge of sampled requests are scaled by 1/rate, so totals
+// remain correct on average. Histograms only receive the sampled requests: their
+// distribution is preserved but their _count and _sum are not scaled.
+// WebSocket and other upgrade requests are always instrumented.
+func WithSampling(route string, rate float64) HttpOption {
+	return func(c *httpConfig) {
+		c.sampling = append(c.sampling, sampleRule{route: route, rate: rate})
+	}
+}
+
+// skipped reports whether the request must not be instrumented at all.
+func (c *httpConfig) skipped(route string, r *http.Request) bool {
+	for _, rule := range c.skip {
+		if rule.match(r.URL.Path) || (route != r.URL.Path && rule.match(route)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sample decides whether the request is instrumented. It returns the weight counters are
+// scaled by, and false if the request is skipped or not part of the sample.
+func (c *httpConfig) sample(route string, r *http.Request) (float64, bool) {
+	if c.skipped(route, r) {
+		return 0, false
+	}
+	for _, rule := range c.sampling {
+		if rule.route != route && rule.route != r.URL.Path {
+			continue
+		}
+		if rule.rate >= 1 || r.Header.Get("Upgrade") != "" {
+			return 1, true
+		}
+		if rule.rate <= 0 || rand.Float64() >= rule.rate {
+			return 0, false
+		}
+		return 1 / rule.rate, true
+	}
+	return 1, true
+}
@@ -0,0 +1,48 @@
+package prometrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSkipRules(t *testing.T) {
+	cfg := newHttpConfig([]HttpOption{
+		WithSkipPaths("/metrics"),
+		WithSkipPathPrefixes("/debug/"),
+		WithSkipPathRegexp(regexp.MustCompile(`^/(healthz|readyz)$`)),
+	})
+
+	tests := map[string]bool{
+		"/metrics":       true,
+		"/metrics/extra": false,
+		"/debug/pprof/":  true,
+		"/readyz":        true,
+		"/person":        false,
+	}
+	for path, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if got := cfg.skipped("default", r); got != want {
+			t.Errorf("skipped(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestSamplingScalesCounters(t *testing.T) {
+	path := "/" + uniqueTestName("test-sampled")
+	handler := InstrumentHttpHandler(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithSampling(path, 0.25))
+
+	const n = 4000
+	for i := 0; i < n; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	got := testutil.ToFloat64(HttpRequestsTotal.WithLabelValues(path, "get", "200"))
+	if got < n*0.8 || got > n*1.2 {
+		t.Errorf("scaled requests total = %v, want about %d", got, n)
+	}
+}
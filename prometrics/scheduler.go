@@ -0,0 +1,231 @@
+package prometrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+var (
+	// CollectorDuration measures how long each run of a periodic collector took, labeled by
+	// collector name.
+	//
+	// Metric type: HistogramVec
+	CollectorDuration = CreateHistogram("prometric_collector_duration_seconds", "Duration of periodic collector runs in seconds.", []string{"collector"}, nil)
+	// CollectorErrors counts the failed runs of periodic collectors, labeled by collector name.
+	// Errors, timeouts and recovered panics are all counted.
+	//
+	// Metric type: CounterVec
+	CollectorErrors = CreateCounter("prometric_collector_errors_total", "Total failed periodic collector runs.", []string{"collector"})
+)
+
+// DefaultScheduler is the Scheduler used by RegisterPeriodicCollector and RunPeriodicCollectors.
+// Its logger is also the one of the messages of the package, see WithLogger.
+var DefaultScheduler = NewScheduler()
+
+// logger returns the logger of the messages of the package, the logger of DefaultScheduler.
+func logger() *slog.Logger { return DefaultScheduler.logger }
+
+// CollectFunc refreshes some metrics, eg. sets a queue depth gauge. The context is
+// cancelled when the collector times out or the scheduler stops.
+type CollectFunc func(ctx context.Context) error
+
+// CollectorOption configures a periodic collector.
+type CollectorOption func(*periodicCollector)
+
+// WithJitter delays every run of the collector by a random duration up to jitter,
+// so collectors of many replicas do not hit a shared backend at the same time.
+func WithJitter(jitter time.Duration) CollectorOption {
+	return func(p *periodicCollector) {
+		p.jitter = jitter
+	}
+}
+
+// WithTimeout cancels the context of a run after timeout. A run that exceeds it is
+// counted as an error. By default a run may take up to its interval.
+func WithTimeout(timeout time.Duration) CollectorOption {
+	return func(p *periodicCollector) {
+		p.timeout = timeout
+	}
+}
+
+type periodicCollector struct {
+	name     string
+	interval time.Duration
+	jitter   time.Duration
+	timeout  time.Duration
+	fn       CollectFunc
+}
+
+// SchedulerOption configures a Scheduler.
+type SchedulerOption func(*Scheduler)
+
+// WithLogger sets the logger of a Scheduler. The default is slog.Default().
+func WithLogger(logger *slog.Logger) SchedulerOption {
+	return func(s *Scheduler) {
+		s.logger = logger
+	}
+}
+
+// Scheduler runs named periodic collectors, each with its own interval, jitter and timeout.
+// Every run is timed in prometric_collector_duration_seconds and failures are counted in
+// prometric_collector_errors_total. A panic inside a collector is recovered and counted
+// as an error, it does not stop the scheduler.
+type Scheduler struct {
+	logger *slog.Logger
+
+	mu         sync.Mutex
+	collectors map[string]*periodicCollector
+	ctx        context.Context
+	wg         sync.WaitGroup
+}
+
+// NewScheduler creates a Scheduler. Collectors start running once Run is called.
+func NewScheduler(opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		logger:     slog.Default(),
+		collectors: make(map[string]*periodicCollector),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register adds a collector that runs fn every interval. Names must be unique within a
+// Scheduler. Collectors registered while the scheduler is running start right away.
+//
+// Example:
+//
+//	s.Register("queue_depth", 15*time.Second, func(ctx context.Context) error {
+//	    n, err := queue.Len(ctx)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    QueueDepth.WithLabelValues("emails").Set(float64(n))
+//	    return nil
+//	}, prometrics.WithJitter(time.Second))
+func (s *Scheduler) Register(name string, interval time.Duration, fn CollectFunc, opts ...CollectorOption) error {
+	if interval <= 0 {
+		return fmt.Errorf("prometrics: collector %q: interval must be positive", name)
+	}
+	p := &periodicCollector{name: name, interval: interval, timeout: interval, fn: fn}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collectors[name]; ok {
+		return fmt.Errorf("prometrics: collector %q already registered", name)
+	}
+	s.collectors[name] = p
+	if s.ctx != nil && s.ctx.Err() == nil {
+		s.start(s.ctx, p)
+	}
+	return nil
+}
+
+// Run runs all registered collectors until ctx is cancelled. It should be called in a
+// go routine and returns once every collector has stopped.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	if s.ctx != nil && s.ctx.Err() == nil {
+		s.mu.Unlock()
+		s.logger.Warn("periodic collectors already running")
+		return
+	}
+	s.ctx = ctx
+	for _, p := range s.collectors {
+		s.start(ctx, p)
+	}
+	s.mu.Unlock()
+
+	<-ctx.Done()
+	s.wg.Wait()
+	s.logger.Info("periodic collectors stopped")
+}
+
+func (s *Scheduler) start(ctx context.Context, p *periodicCollector) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.loop(ctx, p)
+	}()
+}
+
+func (s *Scheduler) loop(ctx context.Context, p *periodicCollector) {
+	timer := time.NewTimer(p.delay(0))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			s.runOnce(ctx, p)
+			timer.Reset(p.delay(p.interval))
+		}
+	}
+}
+
+func (p *periodicCollector) delay(base time.Duration) time.Duration {
+	if p.jitter <= 0 {
+		return base
+	}
+	return base + rand.N(p.jitter)
+}
+
+// runOnce runs the collector once, recording its duration and outcome.
+func (s *Scheduler) runOnce(parent context.Context, p *periodicCollector) {
+	ctx, cancel := context.WithTimeout(parent, p.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := p.call(ctx)
+	elapsed := time.Since(start)
+	CollectorDuration.WithLabelValues(p.name).Observe(elapsed.Seconds())
+
+	switch {
+	case parent.Err() != nil && errors.Is(err, parent.Err()):
+		// cut short because the scheduler stops
+		err = nil
+	case err == nil && elapsed >= p.timeout:
+		// the collector ignored its context
+		err = fmt.Errorf("timed out after %s", p.timeout)
+	case errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil:
+		err = fmt.Errorf("timed out after %s: %w", p.timeout, err)
+	}
+	if err != nil {
+		CollectorErrors.WithLabelValues(p.name).Inc()
+		s.logger.Error("periodic collector failed", "collector", p.name, "error", err)
+	}
+}
+
+func (p *periodicCollector) call(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return p.fn(ctx)
+}
+
+// RegisterPeriodicCollector registers a collector with the DefaultScheduler.
+func RegisterPeriodicCollector(name string, interval time.Duration, fn CollectFunc, opts ...CollectorOption) error {
+	return DefaultScheduler.Register(name, interval, fn, opts...)
+}
+
+// RunPeriodicCollectors runs the DefaultScheduler until ctx is cancelled.
+// It should be called in a go routine.
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	go prometrics.RunPeriodicCollectors(ctx)
+//	// It can be cancelled any time by calling `cancel()`
+func RunPeriodicCollectors(ctx context.Context) {
+	DefaultScheduler.Run(ctx)
+}
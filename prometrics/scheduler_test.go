@@ -0,0 +1,78 @@
+package prometrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestScheduler(t *testing.T) {
+	s := NewScheduler(WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	var runs atomic.Int32
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(s.Register("test_ok", 5*time.Millisecond, func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}, WithJitter(time.Millisecond)))
+	must(s.Register("test_error", 5*time.Millisecond, func(ctx context.Context) error {
+		return errors.New("backend down")
+	}))
+	must(s.Register("test_panic", 5*time.Millisecond, func(ctx context.Context) error {
+		panic("boom")
+	}))
+	must(s.Register("test_timeout", 50*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}, WithTimeout(time.Millisecond)))
+
+	if err := s.Register("test_ok", time.Second, nil); err == nil {
+		t.Error("registering a duplicate collector name succeeded")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Millisecond)
+	defer cancel()
+	s.Run(ctx)
+
+	if runs.Load() < 2 {
+		t.Errorf("collector ran %d times, want at least 2", runs.Load())
+	}
+	for _, name := range []string{"test_error", "test_panic", "test_timeout"} {
+		if got := testutil.ToFloat64(CollectorErrors.WithLabelValues(name)); got < 1 {
+			t.Errorf("errors{%s} = %v, want at least 1", name, got)
+		}
+	}
+	if got := testutil.ToFloat64(CollectorErrors.WithLabelValues("test_ok")); got != 0 {
+		t.Errorf("errors{test_ok} = %v, want 0", got)
+	}
+}
+
+func TestSchedulerShutdownIsNotAnError(t *testing.T) {
+	s := NewScheduler(WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	before := testutil.ToFloat64(CollectorErrors.WithLabelValues("test_shutdown"))
+	if err := s.Register("test_shutdown", time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithTimeout(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	s.Run(ctx)
+
+	if got := testutil.ToFloat64(CollectorErrors.WithLabelValues("test_shutdown")) - before; got != 0 {
+		t.Errorf("errors{test_shutdown} = %v, want 0 for a run stopped by the scheduler", got)
+	}
+}
@@ -0,0 +1,555 @@
+package prometrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// DBQueriesTotal counts the statements run through a wrapped driver, labeled by database
+	// name, operation (query, exec), statement verb (select, insert...) and table, see
+	// WithDBTables and WithDBTableLimit.
+	//
+	// Metric type: CounterVec
+	DBQueriesTotal = CreateCounter("db_queries_total", "Total SQL statements run", []string{"db", "op", "verb", "table"})
+	// DBQueryDuration measures the duration of the statements run through a wrapped driver
+	// in seconds. For queries it is the time until the first row can be read.
+	//
+	// Metric type: HistogramVec
+	DBQueryDuration = CreateHistogram("db_query_duration_seconds", "Duration of SQL statements in seconds", []string{"db", "op", "verb", "table"}, nil)
+	// DBQueryErrors counts the statements that failed, with the same labels as DBQueriesTotal.
+	//
+	// Metric type: CounterVec
+	DBQueryErrors = CreateCounter("db_query_errors_total", "Total failed SQL statements", []string{"db", "op", "verb", "table"})
+	// DBTransactionsTotal counts the transactions ended through a wrapped driver, labeled by
+	// database name and result (commit, rollback, commit_error, rollback_error).
+	//
+	// Metric type: CounterVec
+	DBTransactionsTotal = CreateCounter("db_transactions_total", "Total SQL transactions by result", []string{"db", "result"})
+)
+
+// DBOption configures a driver wrapped by WrapDriver or WrapConnector.
+type DBOption func(*dbConfig)
+
+// WithDBTables records the table label of the statements on the given tables only.
+// Statements on other tables are recorded with table "other".
+func WithDBTables(tables ...string) DBOption {
+	return func(c *dbConfig) {
+		c.tables = make(map[string]bool, len(tables))
+		for _, t := range tables {
+			c.tables[strings.ToLower(t)] = true
+		}
+	}
+}
+
+// WithDBTableLimit caps the number of distinct tables recorded when no tables are given
+// with WithDBTables. Once n tables have been seen, new ones are recorded as "other".
+// The default limit is 100.
+func WithDBTableLimit(n int) DBOption {
+	return func(c *dbConfig) {
+		c.limit = n
+	}
+}
+
+type dbConfig struct {
+	db     string
+	tables map[string]bool
+	limit  int
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newDBConfig(db string, opts []DBOption) *dbConfig {
+	c := &dbConfig{db: db, limit: 100}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WrapDriver wraps a database/sql driver so every statement and transaction is recorded
+// under the database name db. Register the wrapped driver under a new name and open the
+// database with it:
+//
+//	sql.Register("postgres-metrics", prometrics.WrapDriver("main", &pq.Driver{},
+//	    prometrics.WithDBTables("person", "orders")))
+//	db, err := sql.Open("postgres-metrics", dsn)
+//
+// Statements are labeled by verb and table, parsed cheaply from the start of the SQL text.
+// The table label is bounded by WithDBTables or WithDBTableLimit.
+func WrapDriver(db string, d driver.Driver, opts ...DBOption) driver.Driver {
+	return &dbDriver{cfg: newDBConfig(db, opts), driver: d}
+}
+
+// WrapConnector wraps a driver.Connector like WrapDriver, for use with sql.OpenDB:
+//
+//	db := sql.OpenDB(prometrics.WrapConnector("main", connector))
+func WrapConnector(db string, c driver.Connector, opts ...DBOption) driver.Connector {
+	cfg := newDBConfig(db, opts)
+	return &dbConnector{cfg: cfg, connector: c, driver: &dbDriver{cfg: cfg, driver: c.Driver()}}
+}
+
+type dbDriver struct {
+	cfg    *dbConfig
+	driver driver.Driver
+}
+
+func (d *dbDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &dbConn{cfg: d.cfg, conn: conn}, nil
+}
+
+// OpenConnector implements driver.DriverContext.
+func (d *dbDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	if dc, ok := d.driver.(driver.DriverContext); ok {
+		c, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return &dbConnector{cfg: d.cfg, connector: c, driver: d}, nil
+	}
+	return &dbConnector{cfg: d.cfg, connector: dsnConnector{dsn: dsn, driver: d.driver}, driver: d}, nil
+}
+
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.driver }
+
+type dbConnector struct {
+	cfg       *dbConfig
+	connector driver.Connector
+	driver    *dbDriver
+}
+
+func (c *dbConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &dbConn{cfg: c.cfg, conn: conn}, nil
+}
+
+func (c *dbConnector) Driver() driver.Driver { return c.driver }
+
+// dbConn wraps a driver.Conn. The optional interfaces are always implemented and fall back
+// to driver.ErrSkip, or to the behavior of database/sql, when the wrapped conn lacks them.
+type dbConn struct {
+	cfg  *dbConfig
+	conn driver.Conn
+}
+
+func (c *dbConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *dbConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if pc, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = pc.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &dbStmt{cfg: c.cfg, query: query, stmt: stmt, conn: c.conn}
+	if _, ok := stmt.(driver.ColumnConverter); ok {
+		return columnConverterStmt{s}, nil
+	}
+	return s, nil
+}
+
+func (c *dbConn) Close() error { return c.conn.Close() }
+
+func (c *dbConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *dbConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	var err error
+	if bc, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err = bc.BeginTx(ctx, opts)
+	} else {
+		if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+			return nil, errors.New("prometrics: driver does not support non-default transaction options")
+		}
+		tx, err = c.conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dbTx{db: c.cfg.db, tx: tx}, nil
+}
+
+func (c *dbConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := ec.ExecContext(ctx, query, args)
+	c.cfg.observeStatement("exec", query, start, err)
+	return res, err
+}
+
+func (c *dbConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	c.cfg.observeStatement("query", query, start, err)
+	return rows, err
+}
+
+func (c *dbConn) Ping(ctx context.Context) error {
+	if p, ok := c.conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *dbConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *dbConn) IsValid() bool {
+	if v, ok := c.conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *dbConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type dbStmt struct {
+	cfg   *dbConfig
+	query string
+	stmt  driver.Stmt
+	conn  driver.Conn
+}
+
+func (s *dbStmt) Close() error  { return s.stmt.Close() }
+func (s *dbStmt) NumInput() int { return s.stmt.NumInput() }
+
+func (s *dbStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valuesToNamed(args))
+}
+
+func (s *dbStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valuesToNamed(args))
+}
+
+func (s *dbStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var res driver.Result
+	var err error
+	if ec, ok := s.stmt.(driver.StmtExecContext); ok {
+		res, err = ec.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedToValues(args); err == nil {
+			res, err = s.stmt.Exec(values)
+		}
+	}
+	s.cfg.observeStatement("exec", s.query, start, err)
+	return res, err
+}
+
+func (s *dbStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if qc, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err = qc.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedToValues(args); err == nil {
+			rows, err = s.stmt.Query(values)
+		}
+	}
+	s.cfg.observeStatement("query", s.query, start, err)
+	return rows, err
+}
+
+// CheckNamedValue implements driver.NamedValueChecker. database/sql only asks the conn
+// when the stmt is not a checker, so the stmt forwards to the checker of the conn itself.
+func (s *dbStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	if nc, ok := s.conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// columnConverterStmt is a dbStmt whose wrapped stmt implements driver.ColumnConverter.
+// database/sql converts arguments differently for such stmts, so the interface is only
+// implemented when the wrapped stmt does.
+type columnConverterStmt struct{ *dbStmt }
+
+func (s columnConverterStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return s.stmt.(driver.ColumnConverter).ColumnConverter(idx)
+}
+
+func valuesToNamed(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+func namedToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, nv := range args {
+		if nv.Name != "" {
+			return nil, errors.New("prometrics: driver does not support named parameters")
+		}
+		values[i] = nv.Value
+	}
+	return values, nil
+}
+
+type dbTx struct {
+	db string
+	tx driver.Tx
+}
+
+func (t *dbTx) Commit() error {
+	err := t.tx.Commit()
+	t.observe("commit", err)
+	return err
+}
+
+func (t *dbTx) Rollback() error {
+	err := t.tx.Rollback()
+	t.observe("rollback", err)
+	return err
+}
+
+func (t *dbTx) observe(result string, err error) {
+	if err != nil {
+		result += "_error"
+	}
+	DBTransactionsTotal.WithLabelValues(t.db, result).Inc()
+}
+
+// observeStatement records a statement that started at start and ended with err.
+func (c *dbConfig) observeStatement(op, query string, start time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		return
+	}
+	verb, table := parseStatement(query)
+	table = c.label(table)
+	DBQueriesTotal.WithLabelValues(c.db, op, verb, table).Inc()
+	DBQueryDuration.WithLabelValues(c.db, op, verb, table).Observe(time.Since(start).Seconds())
+	if err != nil {
+		DBQueryErrors.WithLabelValues(c.db, op, verb, table).Inc()
+	}
+}
+
+// label bounds the cardinality of the table label.
+func (c *dbConfig) label(table string) string {
+	if table == "" {
+		return ""
+	}
+	if c.tables != nil {
+		if c.tables[table] {
+			return table
+		}
+		return "other"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen[table] {
+		return table
+	}
+	if len(c.seen) >= c.limit {
+		return "other"
+	}
+	if c.seen == nil {
+		c.seen = make(map[string]bool)
+	}
+	c.seen[table] = true
+	return table
+}
+
+var statementVerbs = map[string]bool{
+	"select": true, "insert": true, "update": true, "delete": true, "replace": true, "merge": true,
+	"with": true, "create": true, "alter": true, "drop": true, "truncate": true, "call": true,
+	"begin": true, "commit": true, "rollback": true, "set": true, "show": true, "explain": true,
+}
+
+// parseStatement returns the verb of a SQL statement and the table it works on, eg.
+// ("select", "person") for "SELECT id FROM person WHERE ...". It only scans the leading
+// words of the statement, the table is empty when it cannot be found cheaply and unknown
+// verbs are reported as "other" to keep the label values bounded.
+func parseStatement(query string) (verb, table string) {
+	words := sqlWords(query, 64)
+	if len(words) == 0 {
+		return "other", ""
+	}
+	verb = strings.ToLower(words[0])
+	if !statementVerbs[verb] {
+		return "other", ""
+	}
+
+	after := ""
+	switch verb {
+	case "select", "delete":
+		after = "from"
+	case "insert", "replace", "merge":
+		after = "into"
+	case "update":
+		if len(words) > 1 {
+			return verb, sqlTableName(words[1])
+		}
+	}
+	if after == "" {
+		return verb, ""
+	}
+	for i := 1; i < len(words)-1; i++ {
+		if strings.EqualFold(words[i], after) {
+			return verb, sqlTableName(words[i+1])
+		}
+	}
+	return verb, ""
+}
+
+// sqlWords splits the first limit words of a SQL statement, skipping comments.
+func sqlWords(query string, limit int) []string {
+	var words []string
+	for len(query) > 0 && len(words) < limit {
+		query = strings.TrimLeft(query, " \t\r\n")
+		switch {
+		case strings.HasPrefix(query, "--"):
+			i := strings.IndexByte(query, '\n')
+			if i < 0 {
+				return words
+			}
+			query = query[i:]
+			continue
+		case strings.HasPrefix(query, "/*"):
+			i := strings.Index(query, "*/")
+			if i < 0 {
+				return words
+			}
+			query = query[i+2:]
+			continue
+		}
+		end := strings.IndexAny(query, " \t\r\n(,;")
+		if end == 0 {
+			query = query[1:]
+			continue
+		}
+		if end < 0 {
+			end = len(query)
+		}
+		words = append(words, query[:end])
+		query = query[end:]
+	}
+	return words
+}
+
+func sqlTableName(word string) string {
+	return strings.ToLower(strings.Trim(word, "\"`[]"))
+}
+
+// dbStatsCollector is a prometheus.Collector for the connection pool stats of a *sql.DB.
+type dbStatsCollector struct {
+	db *sql.DB
+
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxIdleTimeClosed *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+// RegisterDBStats registers a collector for the sql.DBStats of db with reg, or with
+// prometheus.DefaultRegisterer if reg is nil, labeled by the database name:
+//   - db_max_open_connections{db}
+//   - db_open_connections{db}, db_in_use_connections{db}, db_idle_connections{db}
+//   - db_wait_count_total{db}, db_wait_duration_seconds_total{db}
+//   - db_max_idle_closed_total{db}, db_max_idle_time_closed_total{db}, db_max_lifetime_closed_total{db}
+func RegisterDBStats(reg prometheus.Registerer, name string, db *sql.DB) error {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	labels := prometheus.Labels{"db": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(metric, help, nil, labels)
+	}
+	return reg.Register(&dbStatsCollector{
+		db:                db,
+		maxOpen:           desc("db_max_open_connections", "Maximum number of open connections to the database."),
+		open:              desc("db_open_connections", "Number of established connections, in use and idle."),
+		inUse:             desc("db_in_use_connections", "Number of connections currently in use."),
+		idle:              desc("db_idle_connections", "Number of idle connections."),
+		waitCount:         desc("db_wait_count_total", "Total number of connections waited for."),
+		waitDuration:      desc("db_wait_duration_seconds_total", "Total time blocked waiting for a new connection in seconds."),
+		maxIdleClosed:     desc("db_max_idle_closed_total", "Total connections closed due to SetMaxIdleConns."),
+		maxIdleTimeClosed: desc("db_max_idle_time_closed_total", "Total connections closed due to SetConnMaxIdleTime."),
+		maxLifetimeClosed: desc("db_max_lifetime_closed_total", "Total connections closed due to SetConnMaxLifetime."),
+	})
+}
+
+// Describe implements prometheus.Collector.
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxIdleTimeClosed
+	ch <- c.maxLifetimeClosed
+}
+
+// Collect implements prometheus.Collector.
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(s.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(s.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(s.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(s.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, s.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(s.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxIdleTimeClosed, prometheus.CounterValue, float64(s.MaxIdleTimeClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(s.MaxLifetimeClosed))
+}
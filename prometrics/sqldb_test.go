@@ -0,0 +1,230 @@
+package prometrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeConnector is a minimal driver accepting every statement but those on table "broken".
+// Its transactions fail to end when failTx is set.
+type fakeConnector struct{ failTx bool }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{failTx: c.failTx}, nil
+}
+func (fakeConnector) Driver() driver.Driver { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{}, nil }
+
+type fakeConn struct{ failTx bool }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if strings.Contains(query, "converted") {
+		return &fakeConverterStmt{fakeStmt{query: query}}, nil
+	}
+	return &fakeStmt{query: query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{fail: c.failTx}, nil }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, table := parseStatement(query); table == "broken" {
+		return nil, errors.New("no such table")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return fakeRows{}, nil
+}
+
+type fakeStmt struct{ query string }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) { return fakeRows{}, nil }
+
+// fakeConverterStmt converts every argument to its string form.
+type fakeConverterStmt struct{ fakeStmt }
+
+func (s *fakeConverterStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return fakeStringConverter{}
+}
+
+type fakeStringConverter struct{}
+
+func (fakeStringConverter) ConvertValue(v any) (driver.Value, error) { return fmt.Sprint(v), nil }
+
+type fakeTx struct{ fail bool }
+
+func (t fakeTx) Commit() error   { return t.err() }
+func (t fakeTx) Rollback() error { return t.err() }
+
+func (t fakeTx) err() error {
+	if t.fail {
+		return errors.New("connection lost")
+	}
+	return nil
+}
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string              { return []string{"id"} }
+func (fakeRows) Close() error                   { return nil }
+func (fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+func TestWrapConnector(t *testing.T) {
+	name := uniqueTestName("test-db")
+	db := sql.OpenDB(WrapConnector(name, fakeConnector{}, WithDBTables("person", "Broken")))
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO person (name) VALUES (?)", "asraf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "DELETE FROM broken"); err == nil {
+		t.Error("expected an error for table broken")
+	}
+	rows, err := db.QueryContext(ctx, "SELECT id, name FROM person WHERE id = ?", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if _, err := db.ExecContext(ctx, "DELETE FROM audit"); err != nil {
+		t.Fatal(err)
+	}
+
+	stmt, err := db.PrepareContext(ctx, "UPDATE person SET name = ? WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.ExecContext(ctx, "peek", 1); err != nil {
+		t.Fatal(err)
+	}
+	stmt.Close()
+
+	tx, _ := db.BeginTx(ctx, nil)
+	tx.Commit()
+	tx, _ = db.BeginTx(ctx, nil)
+	tx.Rollback()
+
+	for _, c := range []struct {
+		op, verb, table string
+		want            float64
+	}{
+		{"exec", "insert", "person", 1},
+		{"exec", "delete", "broken", 1},
+		{"query", "select", "person", 1},
+		{"exec", "delete", "other", 1},
+		{"exec", "update", "person", 1},
+	} {
+		if got := testutil.ToFloat64(DBQueriesTotal.WithLabelValues(name, c.op, c.verb, c.table)); got != c.want {
+			t.Errorf("queries{%s,%s,%s} = %v, want %v", c.op, c.verb, c.table, got, c.want)
+		}
+	}
+	if got := testutil.ToFloat64(DBQueryErrors.WithLabelValues(name, "exec", "delete", "broken")); got != 1 {
+		t.Errorf("errors{delete,broken} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(DBTransactionsTotal.WithLabelValues(name, "commit")); got != 1 {
+		t.Errorf("commits = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(DBTransactionsTotal.WithLabelValues(name, "rollback")); got != 1 {
+		t.Errorf("rollbacks = %v, want 1", got)
+	}
+
+	reg := prometheus.NewRegistry()
+	if err := RegisterDBStats(reg, name, db); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := testutil.GatherAndCount(reg, "db_open_connections", "db_wait_count_total"); err != nil || got < 2 {
+		t.Errorf("pool stats series = %d (%v), want at least 2", got, err)
+	}
+}
+
+func TestWrapConnectorDefaults(t *testing.T) {
+	name := uniqueTestName("test-db")
+	db := sql.OpenDB(WrapConnector(name, fakeConnector{failTx: true}, WithDBTableLimit(1)))
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO person (name) VALUES (?)", "asraf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "DELETE FROM audit"); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(DBQueriesTotal.WithLabelValues(name, "exec", "insert", "person")); got != 1 {
+		t.Errorf("queries{insert,person} = %v, want 1 without WithDBTables", got)
+	}
+	if got := testutil.ToFloat64(DBQueriesTotal.WithLabelValues(name, "exec", "delete", "other")); got != 1 {
+		t.Errorf("queries{delete,other} = %v, want 1 over the table limit", got)
+	}
+
+	tx, _ := db.BeginTx(ctx, nil)
+	if err := tx.Commit(); err == nil {
+		t.Error("expected the commit to fail")
+	}
+	tx, _ = db.BeginTx(ctx, nil)
+	if err := tx.Rollback(); err == nil {
+		t.Error("expected the rollback to fail")
+	}
+	for result, want := range map[string]float64{"commit": 0, "rollback": 0, "commit_error": 1, "rollback_error": 1} {
+		if got := testutil.ToFloat64(DBTransactionsTotal.WithLabelValues(name, result)); got != want {
+			t.Errorf("transactions{%s} = %v, want %v", result, got, want)
+		}
+	}
+}
+
+func TestWrapConnectorColumnConverter(t *testing.T) {
+	stmt, err := (&dbConn{cfg: newDBConfig("test-db", nil), conn: &fakeConn{}}).Prepare("SELECT converted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, ok := stmt.(driver.ColumnConverter)
+	if !ok {
+		t.Fatal("the stmt of a driver.ColumnConverter should be one too")
+	}
+	if v, _ := cc.ColumnConverter(0).ConvertValue(1); v != "1" {
+		t.Errorf("ConvertValue(1) = %v, want the driver's \"1\"", v)
+	}
+
+	stmt, err = (&dbConn{cfg: newDBConfig("test-db", nil), conn: &fakeConn{}}).Prepare("SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stmt.(driver.ColumnConverter); ok {
+		t.Error("the stmt should not be a driver.ColumnConverter when the driver's is not")
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	for query, want := range map[string][2]string{
+		"SELECT id FROM person WHERE id = 1":          {"select", "person"},
+		"  -- list\n/* all */ select * from `Person`": {"select", "person"},
+		"INSERT INTO public.person(name) VALUES ($1)": {"insert", "public.person"},
+		"update \"person\" set name = $1":             {"update", "person"},
+		"DELETE FROM person":                          {"delete", "person"},
+		"WITH x AS (SELECT 1) SELECT * FROM x":        {"with", ""},
+		"VACUUM":                                      {"other", ""},
+		"":                                            {"other", ""},
+	} {
+		verb, table := parseStatement(query)
+		if verb != want[0] || table != want[1] {
+			t.Errorf("parseStatement(%q) = %q, %q, want %q, %q", query, verb, table, want[0], want[1])
+		}
+	}
+}
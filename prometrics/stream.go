@@ -0,0 +1,261 @@
+package prometrics
+
+import (
+	"bufio"
+	"context"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Stream kinds detected by the HTTP middlewares.
+const (
+	StreamKindWebSocket = "websocket"
+	StreamKindUpgrade   = "upgrade"
+	StreamKindSSE       = "sse"
+	StreamKindHijacked  = "hijacked"
+	StreamKindStream    = "stream"
+)
+
+type streamContextKey struct{}
+
+// Stream tracks a long-lived connection such as a WebSocket session, a server-sent
+// events response or any other streaming response. While a stream is open it is
+// counted in http_streams_active{path,kind}; when it ends its lifetime is observed
+// in http_stream_duration_seconds instead of http_request_duration_seconds.
+//
+// The HTTP middlewares attach a Stream to every request, which can be retrieved
+// with StreamFromContext to count messages. Connections hijacked through the
+// middleware are wrapped automatically, so bytes are counted without extra code.
+//
+// All methods are safe for concurrent use and are no-ops on a nil *Stream.
+type Stream struct {
+	path    string
+	upgrade string
+	start   time.Time
+
+	mu       sync.Mutex
+	kind     string
+	started  bool
+	closed   bool
+	detached bool
+}
+
+// NewStream starts tracking a stream outside of the HTTP middlewares, eg. for a
+// connection accepted by a custom server. The stream must be ended with Close.
+func NewStream(path, kind string) *Stream {
+	s := &Stream{path: path, start: time.Now()}
+	s.SetKind(kind)
+	return s
+}
+
+// StreamFromContext returns the Stream attached to a request by the HTTP middlewares,
+// or nil if the request was not instrumented.
+//
+// Example, counting WebSocket messages:
+//
+//	stream := prometrics.StreamFromContext(r.Context())
+//	for {
+//	    _, msg, err := conn.ReadMessage()
+//	    if err != nil {
+//	        return
+//	    }
+//	    stream.ReceivedMessage()
+//	}
+func StreamFromContext(ctx context.Context) *Stream {
+	s, _ := ctx.Value(streamContextKey{}).(*Stream)
+	return s
+}
+
+// newRequestStream creates the Stream attached to an instrumented request. It is not
+// started until the request turns out to be a stream.
+func newRequestStream(path string, r *http.Request, start time.Time) *Stream {
+	s := &Stream{path: path, start: start}
+	if up := r.Header.Get("Upgrade"); up != "" && headerContainsToken(r.Header, "Connection", "upgrade") {
+		s.upgrade = StreamKindUpgrade
+		if strings.EqualFold(up, "websocket") {
+			s.upgrade = StreamKindWebSocket
+		}
+	}
+	return s
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Stream) withContext(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), streamContextKey{}, s))
+}
+
+// SetKind marks the request as a long-lived stream of the given kind, for streams the
+// middlewares can not detect on their own. Only the first call has an effect.
+func (s *Stream) SetKind(kind string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startLocked(kind)
+}
+
+func (s *Stream) startLocked(kind string) {
+	if s.started || s.closed {
+		return
+	}
+	s.kind = kind
+	s.started = true
+	HttpStreamsActive.WithLabelValues(s.path, kind).Inc()
+}
+
+// detectResponse starts the stream if the response headers announce a stream.
+func (s *Stream) detectResponse(h http.Header) {
+	if s == nil {
+		return
+	}
+	ct, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	switch ct {
+	case "text/event-stream":
+		s.SetKind(StreamKindSSE)
+	case "application/x-ndjson", "application/stream+json":
+		s.SetKind(StreamKindStream)
+	}
+}
+
+// hijacked starts the stream for a hijacked connection and returns the connection
+// and its buffered reader/writer wrapped to count bytes.
+func (s *Stream) hijacked(conn net.Conn, rw *bufio.ReadWriter) (net.Conn, *bufio.ReadWriter) {
+	if s == nil {
+		return conn, rw
+	}
+	kind := s.upgrade
+	if kind == "" {
+		kind = StreamKindHijacked
+	}
+	s.SetKind(kind)
+	s.mu.Lock()
+	s.detached = true
+	s.mu.Unlock()
+	conn = s.Conn(conn)
+	if rw != nil {
+		// route reads and writes through the counting conn, unless the server already
+		// buffered data from the client which must not be lost
+		r := rw.Reader
+		if r.Buffered() == 0 {
+			r = bufio.NewReader(conn)
+		}
+		rw = bufio.NewReadWriter(r, bufio.NewWriter(conn))
+	}
+	return conn, rw
+}
+
+// end is called by the middlewares when the handler returns. It closes the stream, unless
+// the connection was hijacked, in which case the stream lasts until the connection is closed.
+// The response body size is added to the sent bytes. It reports whether the request was a stream.
+func (s *Stream) end(written int64) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	started, kind, detached := s.started, s.kind, s.detached
+	s.mu.Unlock()
+	if started && written > 0 {
+		HttpStreamBytes.WithLabelValues(s.path, kind, "sent").Add(float64(written))
+	}
+	if !detached {
+		s.Close()
+	}
+	return started
+}
+
+// Close ends the stream, observing its lifetime. Further calls have no effect.
+// Closing a connection returned by Conn closes its stream as well.
+func (s *Stream) Close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if !s.started {
+		return
+	}
+	HttpStreamsActive.WithLabelValues(s.path, s.kind).Dec()
+	HttpStreamDuration.WithLabelValues(s.path, s.kind).Observe(time.Since(s.start).Seconds())
+}
+
+// SentMessage counts a message sent to the client. A request that sends messages
+// is considered a stream, so it is started as "stream" if not detected otherwise.
+func (s *Stream) SentMessage() { s.message("sent") }
+
+// ReceivedMessage counts a message received from the client.
+func (s *Stream) ReceivedMessage() { s.message("received") }
+
+func (s *Stream) message(direction string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.startLocked(StreamKindStream)
+	kind := s.kind
+	s.mu.Unlock()
+	HttpStreamMessages.WithLabelValues(s.path, kind, direction).Inc()
+}
+
+// Conn wraps conn to count the bytes read and written in http_stream_bytes_total.
+// The stream is started as "stream" if not detected otherwise, and ends when the
+// returned connection is closed.
+func (s *Stream) Conn(conn net.Conn) net.Conn {
+	if s == nil {
+		return conn
+	}
+	s.mu.Lock()
+	s.startLocked(StreamKindStream)
+	kind := s.kind
+	s.mu.Unlock()
+	return &streamConn{
+		Conn:     conn,
+		stream:   s,
+		sent:     HttpStreamBytes.WithLabelValues(s.path, kind, "sent"),
+		received: HttpStreamBytes.WithLabelValues(s.path, kind, "received"),
+	}
+}
+
+type streamConn struct {
+	net.Conn
+	stream   *Stream
+	sent     prometheus.Counter
+	received prometheus.Counter
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.received.Add(float64(n))
+	return n, err
+}
+
+func (c *streamConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.sent.Add(float64(n))
+	return n, err
+}
+
+func (c *streamConn) Close() error {
+	c.stream.Close()
+	return c.Conn.Close()
+}
@@ -0,0 +1,146 @@
+package prometrics
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestInstrumentHttpHandlerSSE(t *testing.T) {
+	path := "/" + uniqueTestName("test-sse")
+	handler := InstrumentHttpHandler(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			StreamFromContext(r.Context()).SentMessage()
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if got := testutil.ToFloat64(HttpStreamMessages.WithLabelValues(path, StreamKindSSE, "sent")); got != 3 {
+		t.Errorf("sent messages = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(HttpStreamBytes.WithLabelValues(path, StreamKindSSE, "sent")); got != float64(w.Body.Len()) {
+		t.Errorf("sent bytes = %v, want %d", got, w.Body.Len())
+	}
+	if got := testutil.ToFloat64(HttpStreamsActive.WithLabelValues(path, StreamKindSSE)); got != 0 {
+		t.Errorf("active streams = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(HttpRequestsTotal.WithLabelValues(path, "get", "200")); got != 1 {
+		t.Errorf("requests = %v, want 1", got)
+	}
+	if got := durationSeries(t, path); got != 0 {
+		t.Errorf("request duration series = %d, want 0 for a stream", got)
+	}
+}
+
+// durationSeries counts the series of HttpRequestDuration for path. Currying a vector
+// does not filter what it collects, so the series are matched by label.
+func durationSeries(t *testing.T, path string) int {
+	ch := make(chan prometheus.Metric, 64)
+	go func() {
+		HttpRequestDuration.Collect(ch)
+		close(ch)
+	}()
+	n := 0
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range pb.GetLabel() {
+			if l.GetName() == "path" && l.GetValue() == path {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestInstrumentHttpHandlerUpgrade(t *testing.T) {
+	path := "/" + uniqueTestName("test-ws")
+	closed := make(chan struct{})
+	handler := InstrumentHttpHandler(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		go func() {
+			defer close(closed)
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+			rw.Flush()
+			line, _ := rw.ReadString('\n')
+			rw.WriteString(line)
+			rw.Flush()
+		}()
+	}))
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n", path)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+	if got := testutil.ToFloat64(HttpStreamsActive.WithLabelValues(path, StreamKindWebSocket)); got != 1 {
+		t.Errorf("active streams = %v, want 1 while the connection is open", got)
+	}
+	fmt.Fprint(conn, "ping\n")
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not closed")
+	}
+	if got := testutil.ToFloat64(HttpStreamsActive.WithLabelValues(path, StreamKindWebSocket)); got != 0 {
+		t.Errorf("active streams = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(HttpStreamBytes.WithLabelValues(path, StreamKindWebSocket, "received")); got != 5 {
+		t.Errorf("received bytes = %v, want 5", got)
+	}
+}
+
+func TestInstrumentHttpHandlerOptionalInterfaces(t *testing.T) {
+	for name, c := range map[string]struct {
+		w                 http.ResponseWriter
+		flusher, hijacker bool
+	}{
+		"recorder": {httptest.NewRecorder(), true, false},
+		"plain":    {struct{ http.ResponseWriter }{httptest.NewRecorder()}, false, false},
+	} {
+		handler := InstrumentHttpHandler("/test-interfaces", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := w.(http.Flusher); ok != c.flusher {
+				t.Errorf("%s: Flusher = %v, want %v", name, ok, c.flusher)
+			}
+			if _, ok := w.(http.Hijacker); ok != c.hijacker {
+				t.Errorf("%s: Hijacker = %v, want %v", name, ok, c.hijacker)
+			}
+			if _, ok := w.(http.Pusher); ok {
+				t.Errorf("%s: Pusher advertised", name)
+			}
+		}))
+		handler.ServeHTTP(c.w, httptest.NewRequest(http.MethodGet, "/test-interfaces", nil))
+	}
+}